@@ -26,9 +26,10 @@ import (
 	"os"
 	"time"
 
+	"github.com/atnomoverflow/git-auth/pkg/audit"
+	"github.com/atnomoverflow/git-auth/pkg/config"
 	"github.com/atnomoverflow/git-auth/pkg/gitlab"
 	"github.com/atnomoverflow/git-auth/pkg/ssh"
-	tokenstore "github.com/atnomoverflow/git-auth/pkg/token-store"
 	"github.com/spf13/cobra"
 )
 
@@ -49,36 +50,19 @@ var addKeyCmd = &cobra.Command{
 		if err != nil {
 			logger.Fatal("Token store setup failed: %v", err)
 		}
-		_, err = validateOrRefreshToken(ts, cfg, glc)
-		if err == tokenstore.TokenNotFound || err == gitlab.RefreshTokenFailedError {
-			logger.Fatal("User not logged in!")
-		}
+		token, err := requireLogin(cfg, glc, ts)
 		if err != nil {
-			logger.Fatal("unexpected error: %v", err)
+			logger.Fatal("%v", err)
 		}
-		title := fmt.Sprintf("%s-%s", cfg.SSHPrefix, time.Now().Format("20060102_150405"))
-		//genrate ssh key paire to be added
-		sshManager := ssh.New(cfg.SSHHost,
-			ssh.WithKeyName(cfg.Profile),
-			ssh.WithPath(cfg.SSHPath),
-			ssh.WithPort(cfg.SSHPort))
-
-		privateKeyPath, publicKeyPath, err := sshManager.GenerateSSHKeyPair()
-		if err != nil {
-			logger.Fatal("Error generating SSH key pair: %v\n", err)
+		if _, err := addNewSSHKey(cfg, glc); err != nil {
+			logger.Fatal("%v", err)
 		}
-
-		logger.Info("Generated keys:\nPrivate: %s\nPublic: %s\n", privateKeyPath, publicKeyPath)
-
-		// Read the public key
-		publicKey, err := os.ReadFile(publicKeyPath)
-		if err != nil {
-			logger.Fatal("Error reading public key: %v\n", err)
-		}
-
-		// Add the public key to GitLab
-		if err := glc.AddSSHKey(title, string(publicKey)); err != nil {
-			logger.Fatal("Error adding SSH key to GitLab: %v\n", err)
+		if verifyFlag && !fileWriter.DryRun() {
+			summary, err := verifySSHKey(cfg, glc, token.Token, verifyAttempts)
+			if err != nil {
+				logger.Fatal("%v", err)
+			}
+			logger.Info("%s", summary)
 		}
 
 	},
@@ -86,6 +70,7 @@ var addKeyCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(addKeyCmd)
+	addKeyCmd.Flags().BoolVar(&verifyFlag, "verify", false, "check the new key authenticates over SSH")
 
 	// Here you will define your flags and configuration settings.
 
@@ -97,3 +82,47 @@ func init() {
 	// is called directly, e.g.:
 	// addKeyCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
+
+// addNewSSHKey generates a new key pair for the profile and uploads its public key,
+// returning the title of the key
+func addNewSSHKey(cfg *config.Config, glc *gitlab.GitlabClient) (string, error) {
+	title := fmt.Sprintf("%s-%s", cfg.SSHPrefix, time.Now().Format("20060102_150405"))
+	//genrate ssh key paire to be added
+	sshManager := newSSHManager(cfg)
+
+	privateKeyPath, publicKeyPath, err := sshManager.GenerateSSHKeyPair()
+	if err != nil {
+		return "", fmt.Errorf("Error generating SSH key pair: %w", err)
+	}
+	if fileWriter.DryRun() {
+		logger.Info("would add the new key to GitLab as %s", title)
+		return title, nil
+	}
+
+	logger.Info("Generated keys:\nPrivate: %s\nPublic: %s\n", privateKeyPath, publicKeyPath)
+
+	// Read the public key
+	publicKey, err := os.ReadFile(publicKeyPath)
+	if err != nil {
+		return "", fmt.Errorf("Error reading public key: %w", err)
+	}
+
+	fingerprint, err := ssh.Fingerprint(string(publicKey))
+	if err != nil {
+		return "", err
+	}
+
+	// Add the public key to GitLab
+	keyID, err := glc.AddSSHKey(title, string(publicKey))
+	recordAudit(cfg, glc, audit.Event{
+		Action:      audit.ActionKeyAdd,
+		KeyID:       keyID,
+		KeyTitle:    title,
+		Fingerprint: fingerprint,
+		Path:        privateKeyPath,
+	}, err)
+	if err != nil {
+		return "", fmt.Errorf("Error adding SSH key to GitLab: %w", err)
+	}
+	return title, nil
+}
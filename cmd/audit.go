@@ -0,0 +1,130 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/atnomoverflow/git-auth/pkg/audit"
+	"github.com/atnomoverflow/git-auth/pkg/config"
+	"github.com/atnomoverflow/git-auth/pkg/gitlab"
+	"github.com/atnomoverflow/git-auth/pkg/ssh"
+)
+
+var (
+	// auditUsers caches the GitLab username of each client so recording does not
+	// query the API for every event
+	auditUsersMu sync.Mutex
+	auditUsers   = map[*gitlab.GitlabClient]string{}
+)
+
+// initializeAuditLog opens the audit log next to the token store
+func initializeAuditLog() (*audit.Log, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return audit.New(filepath.Join(home, ".git-auth")), nil
+}
+
+// recordAudit appends an event to the audit log with the profile, host and GitLab user
+// filled in from cfg and glc, which may be nil. A non nil err marks the action as failed.
+// Failing to record is only logged so the action itself is not affected. Nothing is
+// recorded with --dry-run as nothing was changed.
+func recordAudit(cfg *config.Config, glc *gitlab.GitlabClient, event audit.Event, err error) {
+	if fileWriter.DryRun() {
+		return
+	}
+	if cfg != nil {
+		event.Profile = cfg.Profile
+		if u, err := url.Parse(cfg.URL); err == nil {
+			event.Host = u.Hostname()
+		}
+	}
+	if err != nil {
+		event.Outcome = audit.OutcomeFailure
+		event.Error = logger.Redact(err.Error())
+	}
+	if event.User == "" && cfg != nil && glc != nil {
+		event.User = auditUser(cfg, glc)
+	}
+
+	log, err := initializeAuditLog()
+	if err == nil {
+		err = log.Record(event)
+	}
+	if err != nil {
+		logger.Warn("failed to record %s in the audit log: %v", event.Action, err)
+	}
+}
+
+// auditUser returns the username of the client, using the stored token of the
+// profile when the client has not logged in. It is empty when no token works.
+func auditUser(cfg *config.Config, glc *gitlab.GitlabClient) string {
+	auditUsersMu.Lock()
+	defer auditUsersMu.Unlock()
+	if user, ok := auditUsers[glc]; ok {
+		return user
+	}
+
+	token := glc.Token()
+	if token == "" {
+		if ts, err := initializeTokenStore(); err == nil {
+			if stored, err := ts.GetToken(cfg.Profile); err == nil && stored != nil {
+				token = stored.Token
+			}
+		}
+	}
+	user := ""
+	if token != "" {
+		if u, err := glc.GetUser(token); err == nil {
+			user = u.Username
+		} else {
+			logger.Debug("failed to get the user for the audit log: %v", err)
+		}
+	}
+	auditUsers[glc] = user
+	return user
+}
+
+// recordDeletedKeys records the deletion of each key returned by DeleteSSHKeyByTitlePrefix
+// and the failure of the others.
+func recordDeletedKeys(cfg *config.Config, glc *gitlab.GitlabClient, deleted []map[string]interface{}, err error) {
+	for _, key := range deleted {
+		event := audit.Event{Action: audit.ActionKeyDelete}
+		if id, ok := key["id"].(float64); ok {
+			event.KeyID = int(id)
+		}
+		event.KeyTitle, _ = key["title"].(string)
+		if publicKey, ok := key["key"].(string); ok {
+			event.Fingerprint, _ = ssh.Fingerprint(publicKey)
+		}
+		recordAudit(cfg, glc, event, nil)
+	}
+	if err != nil {
+		recordAudit(cfg, glc, audit.Event{Action: audit.ActionKeyDelete}, err)
+	}
+}
@@ -22,8 +22,9 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"time"
+	"fmt"
 
+	"github.com/atnomoverflow/git-auth/pkg/config"
 	"github.com/atnomoverflow/git-auth/pkg/gitlab"
 	tokenstore "github.com/atnomoverflow/git-auth/pkg/token-store"
 	"github.com/spf13/cobra"
@@ -37,45 +38,21 @@ var authCmd = &cobra.Command{
 It checks for an existing token and refreshes it if necessary. If no token is found, it initiates the device flow to get new credentials. 
 Once authenticated, the user's GitLab information is fetched and displayed.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, glc, err := initializeConfigAndGitLabClient()
-		if err != nil {
-			logger.Fatal("Initialization failed: %v", err)
-		}
-		// fetch token from cache and check if we need new login
-		ts, err := initializeTokenStore()
-		if err != nil {
-			logger.Fatal("Token store setup failed: %v", err)
-		}
-		token, err := validateOrRefreshToken(ts, cfg, glc)
-		if err == tokenstore.TokenNotFound || err == gitlab.RefreshTokenFailedError {
-			newToken := glc.InitDeviceFlow()
-			expireAt := time.Now().Unix() + newToken.ExpiresIn
-			updatedToken := &tokenstore.Token{
-				Profile:      cfg.Profile,
-				Token:        newToken.AccessToken,
-				RefreshToken: newToken.RefreshToken,
-				ExpireAt:     expireAt,
+		runForProfiles(cmd.OutOrStdout(), func(cfg *config.Config, glc *gitlab.GitlabClient, ts *tokenstore.TokenStore) (string, error) {
+			token, err := authenticate(cfg, glc, ts)
+			if err != nil {
+				return "", err
 			}
-			if err := ts.AddToken(updatedToken); err != nil {
-				logger.Warn("error saving updated token: %w", err)
+			user, err := glc.GetUser(token.Token)
+			if err != nil {
+				return "", fmt.Errorf("unexpected error: %w", err)
 			}
-			token = updatedToken
-			// set the error to nil
-			err = nil
-		}
-		if err != nil {
-			logger.Fatal("unexpected error: %v", err)
-		}
-		user, err := glc.GetUser(token.Token)
-		if err != nil {
-			logger.Fatal("unexpected error: %v", err)
-		}
-		logger.Info("welcome %s", user.Name)
-		return
-
+			return fmt.Sprintf("welcome %s", user.Name), nil
+		})
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(authCmd)
+	addProfilesFlags(authCmd)
 }
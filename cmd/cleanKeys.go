@@ -22,6 +22,10 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"fmt"
+	"strings"
+
+	"github.com/atnomoverflow/git-auth/pkg/config"
 	"github.com/atnomoverflow/git-auth/pkg/gitlab"
 	tokenstore "github.com/atnomoverflow/git-auth/pkg/token-store"
 	"github.com/spf13/cobra"
@@ -37,33 +41,45 @@ var cleanKeysCmd = &cobra.Command{
 It fetches the authentication token from the cache, verifies if the user is logged in, and checks if the token is valid. 
 If not, it will attempt to refresh the token. After successful authentication, it removes SSH keys associated with the configured prefix.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, glc, err := initializeConfigAndGitLabClient()
-		if err != nil {
-			logger.Fatal("Initialization failed: %v", err)
-		}
-		// fetch token from cache and check if we need new login
-		ts, err := initializeTokenStore()
-		if err != nil {
-			logger.Fatal("Token store setup failed: %v", err)
-		}
-		_, err = validateOrRefreshToken(ts, cfg, glc)
-		if err == tokenstore.TokenNotFound || err == gitlab.RefreshTokenFailedError {
-			logger.Fatal("User not logged in!")
-		}
+		runForProfiles(cmd.OutOrStdout(), func(cfg *config.Config, glc *gitlab.GitlabClient, ts *tokenstore.TokenStore) (string, error) {
+			if _, err := requireLogin(cfg, glc, ts); err != nil {
+				return "", err
+			}
+			prefix := sshKeyPrefix
+			if prefix == "" {
+				prefix = cfg.SSHPrefix
+			}
+			if err := deleteSSHKeys(cfg, glc, prefix); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("deleted keys prefixed with %s", prefix), nil
+		})
+	},
+}
+
+// deleteSSHKeys deletes the keys of the account prefixed with prefix and records each
+// deletion. With --dry-run the keys are only listed.
+func deleteSSHKeys(cfg *config.Config, glc *gitlab.GitlabClient, prefix string) error {
+	if fileWriter.DryRun() {
+		keys, err := glc.ListSSHKeys()
 		if err != nil {
-			logger.Fatal("unexpected error: %v", err)
+			return err
 		}
-
-		if sshKeyPrefix == "" {
-			sshKeyPrefix = cfg.SSHPrefix
+		for _, key := range keys {
+			if title, _ := key["title"].(string); strings.HasPrefix(title, prefix) {
+				logger.Info("would delete the GitLab key %s", title)
+			}
 		}
-		glc.DeleteSSHKeyByTitlePrefix(sshKeyPrefix)
-
-	},
+		return nil
+	}
+	deleted, err := glc.DeleteSSHKeyByTitlePrefix(prefix)
+	recordDeletedKeys(cfg, glc, deleted, err)
+	return err
 }
 
 func init() {
 	rootCmd.AddCommand(cleanKeysCmd)
+	addProfilesFlags(cleanKeysCmd)
 	cleanKeysCmd.Flags().StringVarP(&sshKeyPrefix, "key-prefix", "x", "", "The prefix to match SSH keys for deletion")
 
 }
@@ -0,0 +1,97 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/atnomoverflow/git-auth/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the git-auth configuration",
+	Long:  `The config command groups the subcommands used to check and display the configuration.`,
+}
+
+// configValidateCmd represents the config validate command
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check every profile of the configuration",
+	Long: `This command checks every profile for a parseable url, a non-empty client-id, known GitLab
+OAuth scopes, a valid ssh-port and a writable ssh-path. All problems are reported with the
+file and line they come from, and the command fails if any is found.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		problems, err := newConfigLoader().Validate()
+		if err != nil {
+			logger.Fatal("Configuration could not be read: %v", err)
+		}
+		for _, problem := range problems {
+			fmt.Fprintln(cmd.OutOrStdout(), problem)
+		}
+		if len(problems) > 0 {
+			logger.Fatal("Found %d configuration problem(s)", len(problems))
+		}
+		logger.Info("Configuration is valid")
+	},
+}
+
+// configShowCmd represents the config show command
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective configuration of a profile",
+	Long: `This command prints the configuration of the selected profile after merging every layer,
+together with the layer and file each value comes from.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := newConfigLoader().Load()
+		if err != nil {
+			logger.Fatal("error loading config: %v", err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "profile: %s\n\n", cfg.Profile)
+		printSettings(cmd.OutOrStdout(), cfg)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configShowCmd)
+}
+
+// printSettings prints every key of the profile with its source
+func printSettings(out io.Writer, cfg *config.Config) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+	for _, key := range config.Keys {
+		source, ok := cfg.Sources[key]
+		if !ok {
+			fmt.Fprintf(w, "%s\t\t(unset)\n", key)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", key, cfg.Value(key), source)
+	}
+	w.Flush()
+}
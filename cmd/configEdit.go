@@ -0,0 +1,150 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/atnomoverflow/git-auth/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var configGlobal bool
+
+// configGetCmd represents the config get command
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print the value of a configuration key",
+	Long: `This command prints the effective value of a key for the selected profile. With --global it
+prints the raw top-level value from the user configuration file instead.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		key := args[0]
+		if !configGlobal && isProfileKey(key) {
+			cfg, err := newConfigLoader().Load()
+			if err != nil {
+				logger.Fatal("error loading config: %v", err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), cfg.Value(key))
+			return
+		}
+
+		ed, section := openConfigEditor()
+		raw, ok := ed.Get(section, key)
+		if !ok {
+			logger.Fatal("%s is not set", key)
+		}
+		value, err := config.DecodeValue(raw)
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), config.FormatValue(value))
+	},
+}
+
+// configSetCmd represents the config set command
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a configuration key in the user configuration file",
+	Long: `This command sets a key of the selected profile, or a top-level key with --global, in the
+user configuration file. Comments and formatting of the file are kept. Lists such as scope
+are given as a single argument separated by spaces or commas.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := checkConfigKey(args[0]); err != nil {
+			logger.Fatal("%v", err)
+		}
+		value, err := config.ParseValue(args[0], args[1])
+		if err != nil {
+			logger.Fatal("invalid value for %s: %v", args[0], err)
+		}
+		ed, section := openConfigEditor()
+		ed.Set(section, args[0], value)
+		saveUserConfig(ed)
+	},
+}
+
+// configUnsetCmd represents the config unset command
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "Remove a configuration key from the user configuration file",
+	Long:  `This command removes a key of the selected profile, or a top-level key with --global, from the user configuration file.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ed, section := openConfigEditor()
+		if !ed.Unset(section, args[0]) {
+			logger.Fatal("%s is not set", args[0])
+		}
+		saveUserConfig(ed)
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configUnsetCmd)
+	for _, c := range []*cobra.Command{configGetCmd, configSetCmd, configUnsetCmd} {
+		c.Flags().BoolVarP(&configGlobal, "global", "g", false, "Use the top-level table instead of the profile")
+	}
+}
+
+// openConfigEditor opens the user configuration file and returns the section the
+// command works on: the top-level table with --global, the selected profile otherwise
+func openConfigEditor() (*config.Editor, string) {
+	ed := openUserConfig()
+	if configGlobal {
+		return ed, ""
+	}
+	profile, err := newConfigLoader().SelectedProfile()
+	if err != nil {
+		logger.Fatal("error loading config: %v", err)
+	}
+	return ed, profile
+}
+
+// checkConfigKey rejects the keys config set does not know, so a typo is not written
+// to the file and silently ignored
+func checkConfigKey(key string) error {
+	if isProfileKey(key) {
+		return nil
+	}
+	known := []string{"extends"}
+	if configGlobal {
+		known = []string{"default-profile"}
+	}
+	for _, k := range known {
+		if k == key {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown key %s, expected one of %s", key, strings.Join(append(append([]string(nil), config.Keys...), known...), ", "))
+}
+
+func isProfileKey(key string) bool {
+	for _, k := range config.Keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
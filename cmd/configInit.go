@@ -0,0 +1,149 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/atnomoverflow/git-auth/pkg/config"
+	"github.com/atnomoverflow/git-auth/pkg/gitlab"
+	"github.com/spf13/cobra"
+)
+
+// configInitCmd represents the config init command
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Interactively create a profile by discovering the GitLab instance",
+	Long: `This command asks for a GitLab URL and probes the instance (/api/v4/version,
+/.well-known/openid-configuration, /help/instance_configuration and the clone address
+of a public project) to fill in the SSH host and port, check that the device flow is
+available and suggest scopes. The answers are written as a new profile section in the
+configuration file.
+
+The profile is named after --profile, "default" otherwise.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		in := bufio.NewReader(cmd.InOrStdin())
+		out := cmd.OutOrStdout()
+
+		profile := profileFlag
+		if profile == "" {
+			profile = config.DefaultProfile
+		}
+		loader := newConfigLoader()
+		if existing, err := loader.Profiles(); err == nil {
+			for _, name := range existing {
+				if name == profile {
+					logger.Fatal("Profile %s already exists, choose another one with --profile", profile)
+				}
+			}
+		}
+
+		rawURL, err := prompt(in, out, "GitLab URL", "https://gitlab.com")
+		if err != nil {
+			logger.Fatal("failed to read answer: %v", err)
+		}
+		u, err := url.Parse(strings.TrimSuffix(rawURL, "/"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			logger.Fatal("%s is not an absolute http or https url", rawURL)
+		}
+
+		glc := gitlab.New(u.String(), gitlab.WithLogger(logger))
+		info, err := glc.Discover()
+		if err != nil {
+			logger.Fatal("Discovery of %s failed: %v", u, err)
+		}
+		if info.Version != "" {
+			logger.Info("Found GitLab %s", info.Version)
+		}
+		if !info.DeviceFlow {
+			logger.Warn("The device flow does not seem to be enabled on %s, login will not work", u)
+		}
+		if info.SSHGuessed {
+			logger.Warn("Could not read the SSH address from a public project, check the SSH host and port")
+		}
+
+		fmt.Fprintln(out, "Create an OAuth application under User Settings > Applications, without the")
+		fmt.Fprintln(out, "confidential option, and paste its application ID.")
+		clientID, err := prompt(in, out, "Application ID", "")
+		if err != nil {
+			logger.Fatal("failed to read answer: %v", err)
+		}
+		if clientID == "" {
+			logger.Warn("No application ID given, set client-id in the profile before logging in")
+		}
+		scope, err := prompt(in, out, "Scopes", strings.Join(info.SuggestScopes(), " "))
+		if err != nil {
+			logger.Fatal("failed to read answer: %v", err)
+		}
+		sshHost, err := prompt(in, out, "SSH host", info.SSHHost)
+		if err != nil {
+			logger.Fatal("failed to read answer: %v", err)
+		}
+		answer, err := prompt(in, out, "SSH port", strconv.Itoa(info.SSHPort))
+		if err != nil {
+			logger.Fatal("failed to read answer: %v", err)
+		}
+		sshPort, err := strconv.Atoi(answer)
+		if err != nil || sshPort < 1 || sshPort > 65535 {
+			logger.Fatal("%s is not a valid port", answer)
+		}
+
+		settings := []config.Setting{
+			{Key: "url", Value: u.String()},
+			{Key: "client-id", Value: clientID},
+			{Key: "scope", Value: strings.Fields(scope)},
+			{Key: "ssh-host", Value: sshHost},
+			{Key: "ssh-port", Value: sshPort},
+		}
+		if err := config.AppendProfile(loader.UserFile(), profile, settings, fileWriter); err != nil {
+			logger.Fatal("failed to write profile: %v", err)
+		}
+		logger.Info("Profile %s written to %s, log in with: git-auth auth --profile %s", profile, loader.UserFile(), profile)
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configInitCmd)
+}
+
+// prompt asks a question on out and reads the answer from in, returning def for an empty answer
+func prompt(in *bufio.Reader, out io.Writer, question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(out, "%s: ", question)
+	}
+	answer, err := in.ReadString('\n')
+	if err != nil && (err != io.EOF || answer == "") {
+		return "", err
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
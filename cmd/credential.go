@@ -0,0 +1,209 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/atnomoverflow/git-auth/pkg/audit"
+	"github.com/atnomoverflow/git-auth/pkg/config"
+	"github.com/atnomoverflow/git-auth/pkg/gitlab"
+	tokenstore "github.com/atnomoverflow/git-auth/pkg/token-store"
+	"github.com/spf13/cobra"
+)
+
+// credentialCmd represents the credential command
+var credentialCmd = &cobra.Command{
+	Use:       "credential <get|store|erase>",
+	Short:     "Git credential helper serving GitLab OAuth tokens over HTTPS",
+	ValidArgs: []string{"get", "store", "erase"},
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	Long: `This command implements git's credential helper protocol so HTTPS remotes can use
+the token obtained with the auth command. On "get" it looks for the profile whose url
+matches the requested host, and with credential.useHttpPath whose namespaces hold the
+repository, and answers with the username oauth2 and a valid access token,
+refreshing it when needed. "store" is a no-op since tokens are managed by git-auth, and
+"erase" refreshes the token git reports as rejected, dropping it when the refresh fails.
+
+Configure it for a GitLab instance with:
+  git config --global credential.https://gitlab.example.com.helper '!git-auth credential'`,
+	Run: func(cmd *cobra.Command, args []string) {
+		request, err := readCredentialRequest(cmd.InOrStdin())
+		if err != nil {
+			logger.Fatal("failed to read credential request: %v", err)
+		}
+		cfg, err := findCredentialProfile(request, profileFlag)
+		if err != nil {
+			logger.Fatal("failed to load config: %v", err)
+		}
+		if cfg == nil {
+			logger.Debug("no profile configured for %s://%s", request["protocol"], request["host"])
+			return
+		}
+		glc := newGitlabClient(cfg)
+		ts, err := initializeTokenStore()
+		if err != nil {
+			logger.Fatal("Token store setup failed: %v", err)
+		}
+
+		switch args[0] {
+		case "get":
+			token, err := validateOrRefreshToken(ts, cfg, glc)
+			if err == tokenstore.TokenNotFound || err == gitlab.RefreshTokenFailedError {
+				logger.Warn("profile %s is not logged in, run git-auth auth --profile %s", cfg.Profile, cfg.Profile)
+				return
+			}
+			if err != nil {
+				logger.Fatal("unexpected error: %v", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "username=oauth2\npassword=%s\n", token.Token)
+		case "erase":
+			token, err := ts.GetToken(cfg.Profile)
+			if err != nil || token == nil || token.Token != request["password"] {
+				return
+			}
+			logger.AddSecret(token.Token, token.RefreshToken)
+			// the access token can be revoked or expire early while the refresh token still works
+			if _, err := refreshStoredToken(ts, cfg, glc, token); err == nil {
+				logger.Info("token for profile %s was rejected and has been refreshed", cfg.Profile)
+				return
+			}
+			err = ts.RemoveToken(cfg.Profile)
+			recordAudit(cfg, nil, audit.Event{Action: audit.ActionTokenRevoke, Detail: "rejected by git"}, err)
+			if err != nil {
+				logger.Fatal("failed to remove token: %v", err)
+			}
+			logger.Info("token for profile %s was rejected and has been removed", cfg.Profile)
+		case "store":
+			// tokens are stored by the auth command, nothing to do
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(credentialCmd)
+}
+
+// readCredentialRequest parses the key=value attributes sent by git until a blank line.
+func readCredentialRequest(r io.Reader) (map[string]string, error) {
+	request := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed attribute %q", line)
+		}
+		request[key] = value
+	}
+	return request, scanner.Err()
+}
+
+// findCredentialProfile returns the profile serving the requested url, or nil when none does.
+// A non-empty profile restricts the lookup to that single profile. When several profiles
+// serve the host, the path git sends with credential.useHttpPath selects the one whose
+// namespaces hold the project, the longest namespace winning; otherwise only a single
+// profile without namespaces is used.
+func findCredentialProfile(request map[string]string, profile string) (*config.Config, error) {
+	loader := newConfigLoader()
+	profiles := []string{profile}
+	if profile == "" {
+		var err error
+		if profiles, err = loader.Profiles(); err != nil {
+			return nil, err
+		}
+	}
+
+	var matched []*config.Config
+	for _, name := range profiles {
+		cfg, err := loader.LoadProfile(name)
+		if err != nil {
+			return nil, err
+		}
+		u, err := url.Parse(cfg.URL)
+		if err != nil {
+			logger.Warn("profile %s has an invalid url: %v", name, err)
+			continue
+		}
+		if u.Scheme != request["protocol"] || u.Host != request["host"] {
+			continue
+		}
+		// an instance under a relative url root only serves the paths below it
+		if path := request["path"]; path != "" && !strings.HasPrefix(path, credentialRoot(cfg)) {
+			continue
+		}
+		matched = append(matched, cfg)
+	}
+	if len(matched) < 2 {
+		if len(matched) == 0 {
+			return nil, nil
+		}
+		return matched[0], nil
+	}
+
+	if path := request["path"]; path != "" {
+		var best *config.Config
+		longest := 0
+		for _, cfg := range matched {
+			project := strings.TrimSuffix(strings.TrimPrefix(path, credentialRoot(cfg)), ".git")
+			for _, namespace := range cfg.Namespaces {
+				if config.InNamespace(project, namespace) && len(namespace) > longest {
+					best, longest = cfg, len(namespace)
+				}
+			}
+		}
+		if best != nil {
+			return best, nil
+		}
+	}
+	var catchAll []*config.Config
+	names := make([]string, len(matched))
+	for i, cfg := range matched {
+		names[i] = cfg.Profile
+		if len(cfg.Namespaces) == 0 {
+			catchAll = append(catchAll, cfg)
+		}
+	}
+	if len(catchAll) == 1 {
+		return catchAll[0], nil
+	}
+	logger.Warn("profiles %s all serve %s, set their namespaces and run git config --global credential.useHttpPath true so the repository path selects one",
+		strings.Join(names, ", "), request["host"])
+	return nil, nil
+}
+
+// credentialRoot returns the relative url root of the profile instance as it starts the
+// path git sends, empty or ending with a slash
+func credentialRoot(cfg *config.Config) string {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || strings.Trim(u.Path, "/") == "" {
+		return ""
+	}
+	return strings.Trim(u.Path, "/") + "/"
+}
@@ -0,0 +1,517 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atnomoverflow/git-auth/pkg/config"
+	"github.com/atnomoverflow/git-auth/pkg/gitlab"
+	"github.com/atnomoverflow/git-auth/pkg/ssh"
+	tokenstore "github.com/atnomoverflow/git-auth/pkg/token-store"
+	"github.com/spf13/cobra"
+	xssh "golang.org/x/crypto/ssh"
+)
+
+const doctorTimeout = 10 * time.Second
+
+// doctorReport prints the outcome of each check with what to do about it
+type doctorReport struct {
+	out    io.Writer
+	failed int
+}
+
+func (r *doctorReport) ok(check, format string, args ...interface{}) {
+	fmt.Fprintf(r.out, "[ok]   %s: %s\n", check, fmt.Sprintf(format, args...))
+}
+
+func (r *doctorReport) warn(check, detail, fix string) {
+	r.print("[warn]", check, detail, fix)
+}
+
+func (r *doctorReport) fail(check, detail, fix string) {
+	r.failed++
+	r.print("[fail]", check, detail, fix)
+}
+
+func (r *doctorReport) skip(check, reason string) {
+	fmt.Fprintf(r.out, "[skip] %s: %s\n", check, reason)
+}
+
+func (r *doctorReport) print(status, check, detail, fix string) {
+	fmt.Fprintf(r.out, "%-6s %s: %s\n", status, check, detail)
+	if fix != "" {
+		fmt.Fprintf(r.out, "       fix: %s\n", fix)
+	}
+}
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check every layer between git and GitLab and explain what to fix",
+	Long: `This command checks, in order, everything a git push over SSH depends on for the selected
+profile and tells what to fix when a check fails:
+
+- the configuration files and the profile
+- HTTPS reachability and the TLS certificate of the profile url
+- the stored token and its scopes
+- the permissions and format of the local key and its registration on GitLab
+- the SSH config block generated for the host
+- the known_hosts entry of the host
+- a real SSH handshake to ssh-host:ssh-port with the profile key
+- git's effective core.sshCommand and the remotes of the current repository
+
+It exits with an error when any check fails.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		r := &doctorReport{out: cmd.OutOrStdout()}
+		runDoctor(r)
+		if r.failed > 0 {
+			logger.Fatal("%d checks failed", r.failed)
+		}
+	},
+}
+
+func runDoctor(r *doctorReport) {
+	cfg, ok := checkConfig(r)
+	if !ok {
+		return
+	}
+	glc := newGitlabClient(cfg)
+	online := checkHTTPS(r, cfg, glc)
+	loggedIn := false
+	if online {
+		loggedIn = checkToken(r, cfg, glc)
+	} else {
+		r.skip("token", "the instance is not reachable")
+	}
+
+	sshManager := newSSHManager(cfg)
+	hasKey := checkKey(r, cfg, glc, sshManager, loggedIn)
+	hasBlock := checkSSHConfig(r, sshManager)
+	if hasKey {
+		checkHandshake(r, cfg, sshManager)
+	} else {
+		r.skip("known_hosts", "no usable key to connect with")
+		r.skip("ssh", "no usable key to connect with")
+	}
+	checkGit(r, cfg, hasBlock)
+}
+
+func checkConfig(r *doctorReport) (*config.Config, bool) {
+	loader := newConfigLoader()
+	problems, err := loader.Validate()
+	if err != nil {
+		r.fail("config", err.Error(), "fix the syntax of the file at the reported line")
+		return nil, false
+	}
+	cfg, err := loader.Load()
+	if err != nil {
+		r.fail("config", err.Error(), "choose an existing profile with --profile or run git-auth config init")
+		return nil, false
+	}
+	valid := true
+	for _, problem := range problems {
+		if problem.Profile != cfg.Profile {
+			continue
+		}
+		r.fail("config", problem.String(), fmt.Sprintf("git-auth config set %s <value> --profile %s", problem.Key, cfg.Profile))
+		if problem.Key == "url" {
+			valid = false
+		}
+	}
+	var files []string
+	for _, file := range loader.Files() {
+		if _, err := os.Stat(file.Path); err == nil {
+			files = append(files, file.Path)
+		}
+	}
+	if valid {
+		r.ok("config", "profile %s from %s", cfg.Profile, strings.Join(files, ", "))
+	}
+	return cfg, valid
+}
+
+func checkHTTPS(r *doctorReport, cfg *config.Config, glc *gitlab.GitlabClient) bool {
+	info, err := glc.CheckConnection()
+	if err != nil {
+		var unknownAuthority x509.UnknownAuthorityError
+		var hostname x509.HostnameError
+		var invalid x509.CertificateInvalidError
+		fix := "check your network, VPN and HTTPS_PROXY settings"
+		switch {
+		case errors.As(err, &unknownAuthority):
+			fix = "install the CA certificate of the instance in the system store or point SSL_CERT_FILE to it"
+		case errors.As(err, &hostname):
+			fix = fmt.Sprintf("the certificate does not cover the host of %s, use the url the instance is served on", cfg.URL)
+		case errors.As(err, &invalid):
+			fix = "the certificate is expired or not yet valid, contact the instance administrators or check your clock"
+		}
+		r.fail("https", err.Error(), fix)
+		return false
+	}
+	if info.StatusCode >= 500 {
+		r.fail("https", fmt.Sprintf("%s answered with status %d", cfg.URL, info.StatusCode), "the instance is unavailable, try again later")
+		return false
+	}
+	if info.TLSVersion == "" {
+		r.warn("https", fmt.Sprintf("%s is reachable over plain http", cfg.URL), "use the https url of the instance so tokens are not sent in clear")
+		return true
+	}
+	if left := time.Until(info.CertExpiry); left < 14*24*time.Hour {
+		r.warn("https", fmt.Sprintf("certificate of %s expires on %s", info.CertSubject, info.CertExpiry.Local().Format("2006-01-02")), "tell the instance administrators")
+		return true
+	}
+	r.ok("https", "%s reachable over %s, certificate %s issued by %s valid until %s",
+		cfg.URL, info.TLSVersion, info.CertSubject, info.CertIssuer, info.CertExpiry.Local().Format("2006-01-02"))
+	return true
+}
+
+func checkToken(r *doctorReport, cfg *config.Config, glc *gitlab.GitlabClient) bool {
+	ts, err := initializeTokenStore()
+	if err != nil {
+		r.fail("token", err.Error(), "")
+		return false
+	}
+	token, err := validateOrRefreshToken(ts, cfg, glc)
+	switch {
+	case err == tokenstore.TokenNotFound:
+		r.fail("token", "not logged in", fmt.Sprintf("git-auth auth --profile %s", cfg.Profile))
+		return false
+	case err == gitlab.RefreshTokenFailedError:
+		r.fail("token", "the token expired and could not be refreshed", fmt.Sprintf("git-auth auth --profile %s", cfg.Profile))
+		return false
+	case err != nil:
+		r.fail("token", err.Error(), "")
+		return false
+	}
+
+	info, err := glc.GetTokenInfo(token.Token)
+	if err != nil {
+		r.fail("token", err.Error(), "")
+		return false
+	}
+	user, err := glc.GetUser(token.Token)
+	if err != nil {
+		r.fail("token", err.Error(), "")
+		return false
+	}
+	var missing []string
+	for _, scope := range cfg.Scope {
+		if !contains(info.Scope, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	if !contains(info.Scope, "api") && !contains(missing, "api") {
+		missing = append(missing, "api")
+	}
+	if len(missing) > 0 {
+		r.fail("token", fmt.Sprintf("logged in as %s but the token lacks the scopes %s", user.Username, strings.Join(missing, " ")),
+			fmt.Sprintf("allow the scopes in the GitLab application and the profile scope, remove the %s entry from ~/.git-auth/tokens.json and run git-auth auth --profile %s", cfg.Profile, cfg.Profile))
+		return true
+	}
+	validity := "without expiry"
+	if expiresAt, ok := info.ExpiresAt(); ok {
+		validity = "valid until " + expiresAt.Local().Format("2006-01-02 15:04")
+	}
+	r.ok("token", "logged in as %s, token %s with scopes %s", user.Username, validity, strings.Join(info.Scope, " "))
+	return true
+}
+
+func checkKey(r *doctorReport, cfg *config.Config, glc *gitlab.GitlabClient, sshManager *ssh.SSHManager, loggedIn bool) bool {
+	keyPath := filepath.Join(cfg.SSHPath, cfg.Profile)
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		r.fail("key", fmt.Sprintf("no private key at %s", keyPath), fmt.Sprintf("git-auth add-key --profile %s", cfg.Profile))
+		return false
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		r.fail("key", fmt.Sprintf("%s is readable by others (%#o), ssh refuses to use it", keyPath, perm), fmt.Sprintf("chmod 600 %s", keyPath))
+	}
+	signer, err := sshManager.Signer()
+	if err != nil {
+		r.fail("key", err.Error(), fmt.Sprintf("git-auth add-key --profile %s to generate a new key", cfg.Profile))
+		return false
+	}
+	local, err := sshManager.LocalKey()
+	if err != nil {
+		r.warn("key", err.Error(), fmt.Sprintf("ssh-keygen -y -f %s > %s.pub", keyPath, keyPath))
+	} else if local.Fingerprint != xssh.FingerprintSHA256(signer.PublicKey()) {
+		r.fail("key", fmt.Sprintf("%s.pub does not belong to %s", keyPath, keyPath), fmt.Sprintf("ssh-keygen -y -f %s > %s.pub", keyPath, keyPath))
+		return false
+	}
+	fingerprint := xssh.FingerprintSHA256(signer.PublicKey())
+
+	if !loggedIn {
+		r.ok("key", "%s (%s %s), registration not checked", keyPath, signer.PublicKey().Type(), fingerprint)
+		return true
+	}
+	keys, err := glc.ListSSHKeys()
+	if err != nil {
+		r.warn("key", fmt.Sprintf("could not list the keys of the account: %v", err), "")
+		return true
+	}
+	for _, key := range keys {
+		publicKey, _ := key["key"].(string)
+		if remote, err := ssh.Fingerprint(publicKey); err != nil || remote != fingerprint {
+			continue
+		}
+		title, _ := key["title"].(string)
+		if raw, ok := key["expires_at"].(string); ok && raw != "" {
+			if expires, err := time.Parse(time.RFC3339, raw); err == nil && expires.Before(time.Now()) {
+				r.fail("key", fmt.Sprintf("%s is registered as %s but expired on %s", fingerprint, title, expires.Local().Format("2006-01-02")),
+					fmt.Sprintf("git-auth magic-auth --profile %s", cfg.Profile))
+				return true
+			}
+		}
+		r.ok("key", "%s (%s %s) registered on GitLab as %s", keyPath, signer.PublicKey().Type(), fingerprint, title)
+		return true
+	}
+	r.fail("key", fmt.Sprintf("%s is not registered on the GitLab account", fingerprint), fmt.Sprintf("git-auth magic-auth --profile %s", cfg.Profile))
+	return true
+}
+
+func checkSSHConfig(r *doctorReport, sshManager *ssh.SSHManager) bool {
+	current, err := sshManager.CurrentConfigBlock()
+	if err != nil {
+		r.fail("ssh config", err.Error(), "")
+		return false
+	}
+	expected, err := sshManager.ConfigBlock()
+	if err != nil {
+		r.fail("ssh config", err.Error(), "")
+		return false
+	}
+	if current == "" {
+		r.warn("ssh config", "no block generated for the host, ssh uses its default key and port", "git-auth generate-ssh-config")
+		return false
+	}
+	included, err := sshManager.IsIncluded()
+	if err != nil {
+		r.fail("ssh config", err.Error(), "")
+		return false
+	}
+	if !included {
+		r.fail("ssh config", fmt.Sprintf("%s is not included from ~/.ssh/config", sshManager.ConfigFile()), "git-auth generate-ssh-config")
+		return true
+	}
+	if normalizeBlock(current) != normalizeBlock(expected) {
+		r.fail("ssh config", fmt.Sprintf("the block of the host does not match the profile, expected:\n%s", expected), "git-auth generate-ssh-config")
+		return true
+	}
+	r.ok("ssh config", "block for %s is up to date", sshManager.Address())
+	return true
+}
+
+func normalizeBlock(block string) string {
+	var lines []string
+	for _, line := range strings.Split(block, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func checkHandshake(r *doctorReport, cfg *config.Config, sshManager *ssh.SSHManager) {
+	client, result, err := sshManager.Connect(doctorTimeout)
+	if result != nil && result.HostKey != nil {
+		fingerprint := xssh.FingerprintSHA256(result.HostKey)
+		switch result.HostKeyStatus {
+		case ssh.HostKeyKnown:
+			r.ok("known_hosts", "host key %s of %s is known", fingerprint, sshManager.Address())
+		case ssh.HostKeyMismatch:
+			r.fail("known_hosts", fmt.Sprintf("%s presented %s which differs from known_hosts", sshManager.Address(), fingerprint),
+				fmt.Sprintf("compare with the fingerprints on %s/help/instance_configuration, then ssh-keygen -R %s and git-auth known-hosts", cfg.URL, knownHostsName(cfg, sshManager)))
+		default:
+			r.warn("known_hosts", fmt.Sprintf("%s (%s) is not in known_hosts, ssh will ask to trust it", sshManager.Address(), fingerprint),
+				"run git-auth known-hosts to add the verified host keys")
+		}
+	} else {
+		r.skip("known_hosts", "the server did not present a host key")
+	}
+
+	if err != nil {
+		fix := fmt.Sprintf("check that %s is open from your network, or use HTTPS with the credential helper", sshManager.Address())
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			fix = fmt.Sprintf("the key is not accepted, run git-auth magic-auth --profile %s", cfg.Profile)
+		}
+		r.fail("ssh", err.Error(), fix)
+		return
+	}
+	client.Close()
+	r.ok("ssh", "authenticated to %s as git with the profile key", sshManager.Address())
+}
+
+// knownHostsName returns how the host is written in known_hosts
+func knownHostsName(cfg *config.Config, sshManager *ssh.SSHManager) string {
+	if cfg.HostKeyAlias != "" {
+		return cfg.HostKeyAlias
+	}
+	host, port, _ := net.SplitHostPort(sshManager.Address())
+	if port == "22" {
+		return host
+	}
+	return fmt.Sprintf("'[%s]:%s'", host, port)
+}
+
+func checkGit(r *doctorReport, cfg *config.Config, hasBlock bool) {
+	if _, err := exec.LookPath("git"); err != nil {
+		r.skip("git", "git is not installed")
+		return
+	}
+	keyPath := filepath.Join(cfg.SSHPath, cfg.Profile)
+	sshCommand, source := os.Getenv("GIT_SSH_COMMAND"), "GIT_SSH_COMMAND"
+	if sshCommand == "" {
+		sshCommand, source = gitConfig("core.sshCommand"), "core.sshCommand"
+	}
+	if sshCommand == "" {
+		r.ok("git", "core.sshCommand is not set, git uses ssh and the SSH config")
+	} else if identity := sshIdentity(sshCommand); identity != "" && identity != keyPath {
+		r.warn("git", fmt.Sprintf("%s uses %s instead of the profile key %s", source, identity, keyPath),
+			fmt.Sprintf("unset it or make it use -i %s", keyPath))
+	} else {
+		r.ok("git", "%s is %q", source, sshCommand)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	gitDir, err := config.FindGitDir(wd)
+	if err != nil || gitDir == "" {
+		r.skip("remotes", "not inside a git repository")
+		return
+	}
+	remotes, err := config.ReadRemotes(gitDir)
+	if err != nil {
+		r.fail("remotes", err.Error(), "")
+		return
+	}
+	hosts := map[string]bool{cfg.SSHHost: true, cfg.SSHAlias: true}
+	if u, err := url.Parse(cfg.URL); err == nil {
+		hosts[u.Hostname()] = true
+	}
+	matched := false
+	for _, remote := range remotes {
+		if !hosts[config.RemoteHost(remote.URL)] {
+			continue
+		}
+		matched = true
+		checkRemote(r, cfg, remote, hasBlock)
+	}
+	if !matched {
+		r.skip("remotes", fmt.Sprintf("no remote of this repository points to %s", cfg.SSHHost))
+	}
+}
+
+func checkRemote(r *doctorReport, cfg *config.Config, remote config.Remote, hasBlock bool) {
+	check := "remote " + remote.Name
+	u, err := url.Parse(remote.URL)
+	isURL := err == nil && strings.Contains(remote.URL, "://")
+	if isURL && (u.Scheme == "https" || u.Scheme == "http") {
+		helper := gitConfig("--get-urlmatch", "credential.helper", remote.URL)
+		if !strings.Contains(helper, "git-auth") {
+			r.warn(check, fmt.Sprintf("%s uses HTTPS without the git-auth credential helper", remote.URL),
+				fmt.Sprintf("git config --global credential.%s.helper '!git-auth credential'", cfg.URL))
+			return
+		}
+		r.ok(check, "%s uses HTTPS with the git-auth credential helper", remote.URL)
+		return
+	}
+
+	user, port := "", 22
+	if isURL {
+		user = u.User.Username()
+		if p, err := strconv.Atoi(u.Port()); err == nil {
+			port = p
+		}
+	} else if at := strings.Index(remote.URL, "@"); at >= 0 && at < strings.Index(remote.URL, ":") {
+		user = remote.URL[:at]
+	}
+	if user != "" && user != cfg.SSHUser {
+		r.fail(check, fmt.Sprintf("%s connects as %s, GitLab only accepts the %s user", remote.URL, user, cfg.SSHUser),
+			fmt.Sprintf("git remote set-url %s with %s@ instead of %s@", remote.Name, cfg.SSHUser, user))
+		return
+	}
+	if !isURL && !hasBlock && cfg.SSHPort != 22 {
+		r.fail(check, fmt.Sprintf("%s uses port 22 but the profile ssh-port is %d", remote.URL, cfg.SSHPort),
+			"git-auth generate-ssh-config, or use an ssh:// url with the port")
+		return
+	}
+	if isURL && u.Port() != "" && port != cfg.SSHPort {
+		r.fail(check, fmt.Sprintf("%s uses port %d but the profile ssh-port is %d", remote.URL, port, cfg.SSHPort),
+			fmt.Sprintf("git remote set-url %s with port %d", remote.Name, cfg.SSHPort))
+		return
+	}
+	r.ok(check, "%s uses SSH as git", remote.URL)
+}
+
+// gitConfig returns a git configuration value, empty when it is not set
+func gitConfig(args ...string) string {
+	if len(args) == 1 {
+		args = []string{"--get", args[0]}
+	}
+	out, err := exec.Command("git", append([]string{"config"}, args...)...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// sshIdentity returns the file given with -i to an ssh command line
+func sshIdentity(command string) string {
+	fields := strings.Fields(command)
+	for i, field := range fields {
+		if field == "-i" && i+1 < len(fields) {
+			return strings.Trim(fields[i+1], `'"`)
+		}
+		if strings.HasPrefix(field, "-i") && len(field) > 2 {
+			return strings.Trim(field[2:], `'"`)
+		}
+	}
+	return ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,142 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/atnomoverflow/git-auth/pkg/config"
+	"github.com/atnomoverflow/git-auth/pkg/gitlab"
+	tokenstore "github.com/atnomoverflow/git-auth/pkg/token-store"
+	"github.com/spf13/cobra"
+)
+
+// execCmd represents the exec command
+var execCmd = &cobra.Command{
+	Use:   "exec -- <command> [args...]",
+	Short: "Run a command with the profile's GitLab credentials in its environment",
+	Long: `This command runs the given command with GITLAB_TOKEN, GITLAB_HOST, CI_SERVER_URL and
+GIT_SSH_COMMAND set for the selected profile, so tools like glab or terraform can use the
+login managed by git-auth. The token is refreshed first if needed.
+
+  git-auth exec --profile work -- glab mr list`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		env := loadProfileEnv()
+
+		child := exec.Command(args[0], args[1:]...)
+		child.Stdin = os.Stdin
+		child.Stdout = os.Stdout
+		child.Stderr = os.Stderr
+		child.Env = os.Environ()
+		for _, key := range sortedKeys(env) {
+			child.Env = append(child.Env, fmt.Sprintf("%s=%s", key, env[key]))
+		}
+
+		if err := child.Run(); err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				os.Exit(exitErr.ExitCode())
+			}
+			logger.Fatal("failed to run %s: %v", args[0], err)
+		}
+	},
+}
+
+// envCmd represents the env command
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Print shell export lines with the profile's GitLab credentials",
+	Long: `This command prints export lines for GITLAB_TOKEN, GITLAB_HOST, CI_SERVER_URL and
+GIT_SSH_COMMAND for the selected profile, meant to be evaluated by the shell:
+
+  eval "$(git-auth env --profile work)"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		env := loadProfileEnv()
+		for _, key := range sortedKeys(env) {
+			fmt.Fprintf(cmd.OutOrStdout(), "export %s=%s\n", key, shellQuote(env[key]))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+	// flags after the command name belong to the command
+	execCmd.Flags().SetInterspersed(false)
+	rootCmd.AddCommand(envCmd)
+}
+
+// loadProfileEnv logs in with the stored token and returns the variables to inject.
+func loadProfileEnv() map[string]string {
+	cfg, glc, err := initializeConfigAndGitLabClient()
+	if err != nil {
+		logger.Fatal("Initialization failed: %v", err)
+	}
+	ts, err := initializeTokenStore()
+	if err != nil {
+		logger.Fatal("Token store setup failed: %v", err)
+	}
+	token, err := validateOrRefreshToken(ts, cfg, glc)
+	if err == tokenstore.TokenNotFound || err == gitlab.RefreshTokenFailedError {
+		logger.Fatal("User not logged in!")
+	}
+	if err != nil {
+		logger.Fatal("unexpected error: %v", err)
+	}
+	return profileEnv(cfg, token.Token)
+}
+
+// profileEnv returns the environment variables exposing the profile's credentials.
+// GIT_SSH_COMMAND is left out when the profile has no key.
+func profileEnv(cfg *config.Config, token string) map[string]string {
+	env := map[string]string{
+		"GITLAB_TOKEN":  token,
+		"GITLAB_HOST":   cfg.URL,
+		"CI_SERVER_URL": cfg.URL,
+	}
+	key, err := newSSHManager(cfg).LocalKey()
+	if err != nil {
+		logger.Warn("no key for profile %s (%v), GIT_SSH_COMMAND is not set; run git-auth add-key --profile %s", cfg.Profile, err, cfg.Profile)
+		return env
+	}
+	env["GIT_SSH_COMMAND"] = fmt.Sprintf("ssh -i %s -o IdentitiesOnly=yes", shellQuote(key.Path))
+	return env
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// shellQuote quotes s for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
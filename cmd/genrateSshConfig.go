@@ -1,10 +1,14 @@
 package cmd
 
 import (
-	"github.com/atnomoverflow/git-auth/pkg/ssh"
+	"fmt"
+
+	"github.com/atnomoverflow/git-auth/pkg/audit"
 	"github.com/spf13/cobra"
 )
 
+var skipKnownHostsFlag bool
+
 type SSHConfig struct {
 	Host         string
 	HostName     string
@@ -21,23 +25,41 @@ details into the user's SSH config file located at ~/.ssh/config. If the configu
 already exists, it will update the configuration for the host rather than appending.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Initialize config and client (assuming initializeConfigAndGitLabClient exists)
-		cfg, _, err := initializeConfigAndGitLabClient()
+		cfg, glc, err := initializeConfigAndGitLabClient()
 		if err != nil {
 			logger.Fatal("Initialization failed: %v", err)
 		}
-		sshManager := ssh.New(cfg.SSHHost,
-			ssh.WithKeyName(cfg.Profile),
-			ssh.WithPath(cfg.SSHPath),
-			ssh.WithPort(cfg.SSHPort))
+		if !skipKnownHostsFlag {
+			summary, err := updateKnownHosts(cfg, glc)
+			if err != nil {
+				logger.Fatal("known_hosts update failed: %v", err)
+			}
+			logger.Info("%s", summary)
+		}
+		sshManager := newSSHManager(cfg)
 		err = sshManager.AddSSHConfig()
+		recordAudit(cfg, glc, audit.Event{
+			Action: audit.ActionSSHConfigEdit,
+			Path:   sshManager.ConfigFile(),
+			Detail: fmt.Sprintf("Host %s", cfg.SSHAlias),
+		}, err)
 		if err != nil {
 			logger.Fatal("SSH config genration failed: %v", err)
 		}
-		logger.Info("SSH configuration successfully generated and appended for host: %s", cfg.SSHHost)
+		logger.Info("SSH configuration successfully generated and appended for host: %s", cfg.SSHAlias)
+		summary, err := updateURLRewrites(cfg, glc)
+		if err != nil {
+			logger.Fatal("git url rewrites failed: %v", err)
+		}
+		if summary != "" {
+			logger.Info("%s", summary)
+		}
 
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(generateSshConfigCmd)
+	generateSshConfigCmd.Flags().BoolVar(&skipKnownHostsFlag, "skip-known-hosts", false, "do not add the verified host keys to known_hosts")
+	generateSshConfigCmd.Flags().BoolVar(&acceptUnverifiedFlag, "accept-unverified", false, "trust the host keys when there are no fingerprints to check them against")
 }
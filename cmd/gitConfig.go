@@ -0,0 +1,237 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/atnomoverflow/git-auth/pkg/audit"
+	"github.com/atnomoverflow/git-auth/pkg/config"
+	"github.com/atnomoverflow/git-auth/pkg/gitconfig"
+	"github.com/atnomoverflow/git-auth/pkg/gitlab"
+)
+
+// gitConfigMu keeps profiles edited in parallel from overwriting each other's changes
+var gitConfigMu sync.Mutex
+
+// editGitConfig applies edit to the git configuration file at path and writes the result
+// through the file writer, so it is backed up or shown with --dry-run
+func editGitConfig(path string, edit func(f *gitconfig.File) error) error {
+	gitConfigMu.Lock()
+	defer gitConfigMu.Unlock()
+	f, err := gitconfig.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := edit(f); err != nil {
+		return err
+	}
+	return f.Save(fileWriter)
+}
+
+// localGitConfig returns the config file of the repository containing the working directory
+func localGitConfig() (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	gitDir, err := config.FindGitDir(wd)
+	if err != nil {
+		return "", err
+	}
+	if gitDir == "" {
+		return "", errors.New("not inside a git repository")
+	}
+	return gitconfig.LocalPath(gitDir), nil
+}
+
+// urlRewritePrefix starts the url.<base>.insteadOf sections pointing to the alias of the profile
+func urlRewritePrefix(cfg *config.Config) string {
+	return cfg.SSHUser + "@" + cfg.SSHAlias + ":"
+}
+
+// urlRewrites returns the insteadOf values of each namespace of the profile, by base url.
+// Nothing is rewritten when the alias is the host itself.
+func urlRewrites(cfg *config.Config) map[string][]string {
+	rewrites := map[string][]string{}
+	if cfg.SSHAlias == cfg.SSHHost {
+		return rewrites
+	}
+	for _, namespace := range cfg.Namespaces {
+		base := urlRewritePrefix(cfg) + namespace + "/"
+		rewrites[base] = []string{
+			fmt.Sprintf("%s@%s:%s/", cfg.SSHUser, cfg.SSHHost, namespace),
+			fmt.Sprintf("ssh://%s@%s/%s/", cfg.SSHUser, cfg.SSHHost, namespace),
+		}
+		if cfg.SSHPort != 22 {
+			rewrites[base] = append(rewrites[base], fmt.Sprintf("ssh://%s@%s:%d/%s/", cfg.SSHUser, cfg.SSHHost, cfg.SSHPort, namespace))
+		}
+	}
+	return rewrites
+}
+
+// currentURLRewrites returns the insteadOf values of the sections pointing to the alias
+// of the profile, by base url
+func currentURLRewrites(f *gitconfig.File, cfg *config.Config) (map[string][]string, error) {
+	entries, err := f.GetRegexp(`^url\..*\.insteadof$`)
+	if err != nil {
+		return nil, err
+	}
+	current := map[string][]string{}
+	for _, e := range entries {
+		base := strings.TrimSuffix(strings.TrimPrefix(e.Key, "url."), ".insteadof")
+		if strings.HasPrefix(base, urlRewritePrefix(cfg)) {
+			current[base] = append(current[base], e.Value)
+		}
+	}
+	return current, nil
+}
+
+// updateURLRewrites makes the global git config rewrite the remotes of the namespaces of
+// the profile to its alias, removing the rewrites of namespaces no longer configured
+func updateURLRewrites(cfg *config.Config, glc *gitlab.GitlabClient) (string, error) {
+	if len(cfg.Namespaces) > 0 && cfg.SSHAlias == cfg.SSHHost {
+		logger.Warn("%s: namespaces are only rewritten to an ssh-alias different from %s", cfg.Profile, cfg.SSHHost)
+	}
+	path, err := gitconfig.GlobalPath()
+	if err != nil {
+		return "", err
+	}
+	wanted := urlRewrites(cfg)
+	changed := 0
+	err = editGitConfig(path, func(f *gitconfig.File) error {
+		current, err := currentURLRewrites(f, cfg)
+		if err != nil {
+			return err
+		}
+		for base, values := range current {
+			if !equalValues(values, wanted[base]) {
+				if err := f.RemoveSection("url." + base); err != nil {
+					return err
+				}
+				changed++
+			}
+		}
+		for base, values := range wanted {
+			if equalValues(values, current[base]) {
+				continue
+			}
+			for _, value := range values {
+				if err := f.Add("url."+base+".insteadOf", value); err != nil {
+					return err
+				}
+			}
+			changed++
+		}
+		return nil
+	})
+	if changed == 0 && err == nil {
+		return "", nil
+	}
+	recordAudit(cfg, glc, audit.Event{
+		Action: audit.ActionGitConfigEdit,
+		Path:   path,
+		Detail: fmt.Sprintf("url rewrites to %s for %s", cfg.SSHAlias, strings.Join(cfg.Namespaces, ", ")),
+	}, err)
+	if err != nil {
+		return "", err
+	}
+	if len(wanted) == 0 {
+		return fmt.Sprintf("removed the url rewrites to Host %s from %s", cfg.SSHAlias, path), nil
+	}
+	return fmt.Sprintf("%d namespaces rewritten to Host %s in %s", len(wanted), cfg.SSHAlias, path), nil
+}
+
+// removeURLRewrites removes the url rewrites pointing to the alias of the profile from the
+// global git config, returning how many were removed
+func removeURLRewrites(cfg *config.Config, glc *gitlab.GitlabClient) (int, error) {
+	if cfg.SSHAlias == cfg.SSHHost {
+		return 0, nil
+	}
+	path, err := gitconfig.GlobalPath()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	err = editGitConfig(path, func(f *gitconfig.File) error {
+		current, err := currentURLRewrites(f, cfg)
+		if err != nil {
+			return err
+		}
+		for base := range current {
+			if err := f.RemoveSection("url." + base); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	if removed == 0 {
+		return 0, err
+	}
+	recordAudit(cfg, glc, audit.Event{
+		Action: audit.ActionGitConfigEdit,
+		Path:   path,
+		Detail: fmt.Sprintf("removed the url rewrites to %s", cfg.SSHAlias),
+	}, err)
+	return removed, err
+}
+
+// countURLRewrites returns how many url rewrites point to the alias of the profile
+func countURLRewrites(cfg *config.Config) (int, error) {
+	if cfg.SSHAlias == cfg.SSHHost {
+		return 0, nil
+	}
+	path, err := gitconfig.GlobalPath()
+	if err != nil {
+		return 0, err
+	}
+	f, err := gitconfig.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	current, err := currentURLRewrites(f, cfg)
+	return len(current), err
+}
+
+// equalValues reports whether a and b hold the same values in any order
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string{}, a...), append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
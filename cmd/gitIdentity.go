@@ -0,0 +1,208 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/atnomoverflow/git-auth/pkg/audit"
+	"github.com/atnomoverflow/git-auth/pkg/config"
+	"github.com/atnomoverflow/git-auth/pkg/gitconfig"
+	"github.com/atnomoverflow/git-auth/pkg/gitlab"
+	tokenstore "github.com/atnomoverflow/git-auth/pkg/token-store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	globalFlag bool
+	localFlag  bool
+	emailFlag  string
+)
+
+// gitIdentityCmd represents the git-identity command
+var gitIdentityCmd = &cobra.Command{
+	Use:   "git-identity",
+	Short: "Set git user.name and user.email from the GitLab account",
+	Long: `This command sets user.name and user.email from the GitLab user of the profile, in the global
+git config by default or in the current repository with --local.
+
+The email is one GitLab reports as confirmed on /user/emails: the one given with --email, the
+one already set when it is confirmed, else the primary email of the account, else another
+confirmed email. --email can also select the private noreply commit email of the account. GitLab push
+rules can reject commits whose author email is not verified, so a warning is printed when
+the email git uses here is not one of them.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if globalFlag && localFlag {
+			logger.Fatal("--global and --local cannot be used together")
+		}
+		path, err := gitconfig.GlobalPath()
+		if localFlag {
+			path, err = localGitConfig()
+		}
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+		runForProfiles(cmd.OutOrStdout(), func(cfg *config.Config, glc *gitlab.GitlabClient, ts *tokenstore.TokenStore) (string, error) {
+			return setGitIdentity(cfg, glc, ts, path)
+		})
+	},
+}
+
+// setGitIdentity writes the name and a verified email of the GitLab user to the git config
+// file at path
+func setGitIdentity(cfg *config.Config, glc *gitlab.GitlabClient, ts *tokenstore.TokenStore, path string) (string, error) {
+	id, err := fetchIdentity(cfg, glc, ts)
+	if err != nil {
+		return "", err
+	}
+	err = editGitConfig(path, func(f *gitconfig.File) error {
+		return id.apply(f)
+	})
+	recordAudit(cfg, glc, audit.Event{
+		Action: audit.ActionGitConfigEdit,
+		Path:   path,
+		Detail: fmt.Sprintf("user.name %s, user.email %s", id.user.Name, id.email),
+	}, err)
+	if err != nil {
+		return "", err
+	}
+	id.warnEffective()
+	return fmt.Sprintf("%s <%s> set in %s", id.user.Name, id.email, path), nil
+}
+
+// identity is the GitLab user of a profile about to be written to a git config file
+type identity struct {
+	cfg      *config.Config
+	user     *gitlab.GitlabUser
+	verified []string
+	// email is the one chosen by apply
+	email string
+}
+
+// fetchIdentity gets the GitLab user of the profile and its verified emails
+func fetchIdentity(cfg *config.Config, glc *gitlab.GitlabClient, ts *tokenstore.TokenStore) (*identity, error) {
+	token, err := requireLogin(cfg, glc, ts)
+	if err != nil {
+		return nil, err
+	}
+	glc.SetToken(token.Token)
+	user, err := glc.GetUser(token.Token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	verified, err := verifiedEmails(glc, user)
+	if err != nil {
+		return nil, err
+	}
+	return &identity{cfg: cfg, user: user, verified: verified}, nil
+}
+
+// apply sets user.name and a verified user.email in the config file
+func (id *identity) apply(f *gitconfig.File) error {
+	current, err := f.Get("user.email")
+	if err != nil {
+		return err
+	}
+	if id.email, err = chooseEmail(id.user, id.verified, current); err != nil {
+		return err
+	}
+	if current != "" && !isVerified(id.verified, current) {
+		logger.Warn("replacing %s, which is not verified on %s, in %s", current, id.cfg.URL, f.Path())
+	}
+	if err := f.Set("user.name", id.user.Name); err != nil {
+		return err
+	}
+	return f.Set("user.email", id.email)
+}
+
+// warnEffective warns when git still uses an unverified email in the working directory
+// once the identity is written, a repository value taking precedence
+func (id *identity) warnEffective() {
+	if effective := gitConfig("user.email"); !fileWriter.DryRun() && effective != "" && effective != id.email && !isVerified(id.verified, effective) {
+		logger.Warn("git uses user.email %s in this repository, which is not verified on %s, commits using it can be rejected on push, run git-auth git-identity --local", effective, id.cfg.URL)
+	}
+}
+
+// verifiedEmails returns the emails /user/emails reports as confirmed, the primary email
+// first. The primary and commit emails of the user are not trusted on their own.
+func verifiedEmails(glc *gitlab.GitlabClient, user *gitlab.GitlabUser) ([]string, error) {
+	emails, err := glc.GetEmails()
+	if err != nil {
+		return nil, err
+	}
+	var verified []string
+	for _, email := range emails {
+		if email.Verified() && !isVerified(verified, email.Email) {
+			if strings.EqualFold(email.Email, user.Email) {
+				verified = append([]string{email.Email}, verified...)
+			} else {
+				verified = append(verified, email.Email)
+			}
+		}
+	}
+	if len(verified) == 0 {
+		return nil, errors.New("the GitLab account has no verified email, is the read_user or api scope granted?")
+	}
+	return verified, nil
+}
+
+// chooseEmail picks the email given with --email, else the current one when verified,
+// else the first verified email. --email may also select the private commit email
+// GitLab generates, which /user/emails does not list.
+func chooseEmail(user *gitlab.GitlabUser, verified []string, current string) (string, error) {
+	if emailFlag != "" {
+		if isVerified(verified, emailFlag) || (strings.EqualFold(emailFlag, user.CommitEmail) && isNoreplyEmail(emailFlag)) {
+			return emailFlag, nil
+		}
+		return "", fmt.Errorf("%s is not a verified email of @%s, choose one of %s", emailFlag, user.Username, strings.Join(verified, ", "))
+	}
+	if isVerified(verified, current) {
+		return current, nil
+	}
+	return verified[0], nil
+}
+
+// isNoreplyEmail reports whether email is a private commit email of GitLab, such as
+// 1234-jdoe@users.noreply.gitlab.com
+func isNoreplyEmail(email string) bool {
+	return strings.Contains(strings.ToLower(email), "@users.noreply.")
+}
+
+// isVerified reports whether email is one of the verified emails, ignoring case
+func isVerified(verified []string, email string) bool {
+	for _, v := range verified {
+		if strings.EqualFold(v, email) {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	rootCmd.AddCommand(gitIdentityCmd)
+	gitIdentityCmd.Flags().BoolVar(&globalFlag, "global", false, "set the identity in the global git config (default)")
+	gitIdentityCmd.Flags().BoolVar(&localFlag, "local", false, "set the identity in the config of the current repository")
+	gitIdentityCmd.Flags().StringVar(&emailFlag, "email", "", "confirmed or noreply commit email to use instead of the primary email")
+}
@@ -0,0 +1,143 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/atnomoverflow/git-auth/pkg/audit"
+	"github.com/spf13/cobra"
+)
+
+var (
+	historySince string
+	historyJSON  bool
+)
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show the audit log of logins, token and key changes",
+	Long: `This command prints the audit log kept in ~/.git-auth/audit.jsonl. Every login, token
+refresh and removal, SSH key upload and deletion and SSH config edit is recorded with
+its profile, host, GitLab user and outcome.
+
+--since takes a duration such as 24h or 90d, or a date such as 2024-01-31. Give
+--profile to only show the events of one profile.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		filter := audit.Filter{}
+		if historySince != "" {
+			since, err := parseSince(historySince, time.Now())
+			if err != nil {
+				logger.Fatal("%v", err)
+			}
+			filter.Since = since
+		}
+		if cmd.Flags().Changed("profile") {
+			filter.Profile = profileFlag
+		}
+
+		log, err := initializeAuditLog()
+		if err != nil {
+			logger.Fatal("Audit log setup failed: %v", err)
+		}
+		events, err := log.Read(filter)
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+
+		out := cmd.OutOrStdout()
+		if historyJSON {
+			if events == nil {
+				events = []audit.Event{}
+			}
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(events); err != nil {
+				logger.Fatal("failed to encode history: %v", err)
+			}
+			return
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tACTION\tPROFILE\tHOST\tUSER\tOUTCOME\tDETAILS")
+		for _, e := range events {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				e.Time.Local().Format("2006-01-02 15:04:05"), e.Action, e.Profile, e.Host, e.User, e.Outcome, eventDetails(e))
+		}
+		w.Flush()
+	},
+}
+
+// parseSince reads a duration before now, with a d suffix for days, or a date
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q, use a duration such as 24h or 30d, or a date such as 2024-01-31", value)
+}
+
+// eventDetails summarizes the fields specific to an action
+func eventDetails(e audit.Event) string {
+	var details []string
+	if e.KeyTitle != "" {
+		details = append(details, e.KeyTitle)
+	}
+	if e.KeyID != 0 {
+		details = append(details, fmt.Sprintf("id %d", e.KeyID))
+	}
+	if e.Fingerprint != "" {
+		details = append(details, e.Fingerprint)
+	}
+	if e.Path != "" {
+		details = append(details, e.Path)
+	}
+	if e.Detail != "" {
+		details = append(details, e.Detail)
+	}
+	if e.Error != "" {
+		details = append(details, "error: "+e.Error)
+	}
+	return strings.Join(details, ", ")
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.Flags().StringVar(&historySince, "since", "", "only show events newer than a duration (24h, 30d) or a date")
+	historyCmd.Flags().BoolVar(&historyJSON, "json", false, "print the events as JSON")
+}
@@ -0,0 +1,109 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/atnomoverflow/git-auth/pkg/audit"
+	"github.com/atnomoverflow/git-auth/pkg/config"
+	"github.com/atnomoverflow/git-auth/pkg/gitlab"
+	"github.com/atnomoverflow/git-auth/pkg/ssh"
+	tokenstore "github.com/atnomoverflow/git-auth/pkg/token-store"
+	"github.com/spf13/cobra"
+)
+
+var acceptUnverifiedFlag bool
+
+// knownHostsCmd represents the known-hosts command
+var knownHostsCmd = &cobra.Command{
+	Use:   "known-hosts",
+	Short: "Add the verified SSH host keys of GitLab to known_hosts",
+	Long: `This command fetches the host keys of the profile's ssh-host and ssh-port, checks them against
+the host-key-fingerprints pinned in the profile or, without pins, the fingerprints GitLab
+publishes on /help/instance_configuration, and writes them as hashed entries to the
+known-hosts-file of the profile (~/.ssh/known_hosts by default).
+
+It refuses to write anything when a key does not match. When neither pins nor published
+fingerprints are available, --accept-unverified trusts the keys as they are.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runForProfiles(cmd.OutOrStdout(), func(cfg *config.Config, glc *gitlab.GitlabClient, ts *tokenstore.TokenStore) (string, error) {
+			return updateKnownHosts(cfg, glc)
+		})
+	},
+}
+
+// updateKnownHosts scans the host keys of the profile, verifies them and adds the new ones
+// to its known_hosts file
+func updateKnownHosts(cfg *config.Config, glc *gitlab.GitlabClient) (string, error) {
+	sshManager := newSSHManager(cfg)
+	keys, err := sshManager.Keyscan(doctorTimeout)
+	if err != nil {
+		return "", err
+	}
+
+	expected, source := cfg.HostKeyFingerprints, "the fingerprints pinned in the profile"
+	if len(expected) == 0 {
+		published, err := glc.GetHostKeyFingerprints()
+		if err != nil {
+			logger.Debug("no published host keys: %v", err)
+		}
+		for _, key := range published {
+			expected = append(expected, key.SHA256)
+		}
+		source = fmt.Sprintf("the fingerprints published on %s/help/instance_configuration", cfg.URL)
+	}
+	if len(expected) == 0 {
+		if !acceptUnverifiedFlag {
+			return "", fmt.Errorf("no fingerprints to verify the host keys of %s against, pin them with git-auth config set host-key-fingerprints or pass --accept-unverified", sshManager.Address())
+		}
+		logger.Warn("trusting the host keys of %s without verification", sshManager.Address())
+	} else if err := sshManager.CheckHostKeys(keys, expected); err != nil {
+		var mismatch *ssh.HostKeyMismatchError
+		if errors.As(err, &mismatch) {
+			err = fmt.Errorf("refusing to trust %s: %w (from %s)", sshManager.Address(), err, source)
+		}
+		return "", err
+	}
+
+	added, err := sshManager.AddKnownHosts(keys)
+	recordAudit(cfg, glc, audit.Event{
+		Action: audit.ActionKnownHostsEdit,
+		Path:   sshManager.KnownHostsFile(),
+		Detail: fmt.Sprintf("%d host keys of %s added", added, sshManager.Address()),
+	}, err)
+	if err != nil {
+		return "", err
+	}
+	if added == 0 {
+		return fmt.Sprintf("the host keys of %s are already known", sshManager.Address()), nil
+	}
+	return fmt.Sprintf("added %d verified host keys of %s to %s", added, sshManager.Address(), sshManager.KnownHostsFile()), nil
+}
+
+func init() {
+	rootCmd.AddCommand(knownHostsCmd)
+	addProfilesFlags(knownHostsCmd)
+	knownHostsCmd.Flags().BoolVar(&acceptUnverifiedFlag, "accept-unverified", false, "trust the host keys when there are no fingerprints to check them against")
+}
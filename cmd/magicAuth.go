@@ -23,11 +23,9 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"time"
 
+	"github.com/atnomoverflow/git-auth/pkg/config"
 	"github.com/atnomoverflow/git-auth/pkg/gitlab"
-	"github.com/atnomoverflow/git-auth/pkg/ssh"
 	tokenstore "github.com/atnomoverflow/git-auth/pkg/token-store"
 	"github.com/spf13/cobra"
 )
@@ -54,72 +52,38 @@ magic-auth --profile <profile-name> --ssh-prefix <prefix>
 	
 Ensure your configuration file is correctly set up before using this command to enjoy effortless GitLab integration.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, glc, err := initializeConfigAndGitLabClient()
-		if err != nil {
-			logger.Fatal("Initialization failed: %v", err)
-		}
-		// fetch token from cache and check if we need new login
-		ts, err := initializeTokenStore()
-		if err != nil {
-			logger.Fatal("Token store setup failed: %v", err)
-		}
-		token, err := validateOrRefreshToken(ts, cfg, glc)
-		if err == tokenstore.TokenNotFound || err == gitlab.RefreshTokenFailedError {
-			newToken := glc.InitDeviceFlow()
-			expireAt := time.Now().Unix() + newToken.ExpiresIn
-			updatedToken := &tokenstore.Token{
-				Profile:      cfg.Profile,
-				Token:        newToken.AccessToken,
-				RefreshToken: newToken.RefreshToken,
-				ExpireAt:     expireAt,
+		runForProfiles(cmd.OutOrStdout(), func(cfg *config.Config, glc *gitlab.GitlabClient, ts *tokenstore.TokenStore) (string, error) {
+			token, err := authenticate(cfg, glc, ts)
+			if err != nil {
+				return "", err
 			}
-			if err := ts.AddToken(updatedToken); err != nil {
-				logger.Warn("error saving updated token: %w", err)
+			user, err := glc.GetUser(token.Token)
+			if err != nil {
+				return "", fmt.Errorf("unexpected error: %w", err)
 			}
-			token = updatedToken
-			// set the error to nil
-			err = nil
-
-		}
-		if err != nil {
-			logger.Fatal("unexpected error: %v", err)
-		}
-		user, err := glc.GetUser(token.Token)
-		if err != nil {
-			logger.Fatal("unexpected error: %v", err)
-		}
-		logger.Info("welcome %s", user.Name)
-		glc.SetToken(token.Token)
-		glc.DeleteSSHKeyByTitlePrefix(cfg.SSHPrefix)
-		title := fmt.Sprintf("%s-%s", cfg.SSHPrefix, time.Now().Format("20060102_150405"))
-		//genrate ssh key paire to be added
-		sshManager := ssh.New(cfg.SSHHost,
-			ssh.WithKeyName(cfg.Profile),
-			ssh.WithPath(cfg.SSHPath),
-			ssh.WithPort(cfg.SSHPort))
-
-		privateKeyPath, publicKeyPath, err := sshManager.GenerateSSHKeyPair()
-		if err != nil {
-			logger.Fatal("Error generating SSH key pair: %v\n", err)
-		}
-
-		logger.Info("Generated keys:\nPrivate: %s\nPublic: %s\n", privateKeyPath, publicKeyPath)
-
-		// Read the public key
-		publicKey, err := os.ReadFile(publicKeyPath)
-		if err != nil {
-			logger.Fatal("Error reading public key: %v\n", err)
-		}
-
-		// Add the public key to GitLab
-		if err := glc.AddSSHKey(title, string(publicKey)); err != nil {
-			logger.Fatal("Error adding SSH key to GitLab: %v\n", err)
-		}
-
+			logger.Info("welcome %s", user.Name)
+			glc.SetToken(token.Token)
+			if err := deleteSSHKeys(cfg, glc, cfg.SSHPrefix); err != nil {
+				return "", err
+			}
+			title, err := addNewSSHKey(cfg, glc)
+			if err != nil {
+				return "", err
+			}
+			if verifyFlag && !fileWriter.DryRun() {
+				if _, err := verifySSHKey(cfg, glc, token.Token, verifyAttempts); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("%s logged in, key %s added and verified over SSH", user.Username, title), nil
+			}
+			return fmt.Sprintf("%s logged in, key %s added", user.Username, title), nil
+		})
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(magicAuthCmd)
+	addProfilesFlags(magicAuthCmd)
+	magicAuthCmd.Flags().BoolVar(&verifyFlag, "verify", false, "check the new key authenticates over SSH")
 
 }
@@ -0,0 +1,220 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/atnomoverflow/git-auth/pkg/audit"
+	"github.com/atnomoverflow/git-auth/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	profileURL      string
+	profileClientID string
+)
+
+// profileCmd represents the profile command
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage the profiles of the user configuration file",
+	Long: `The profile command creates, renames, copies and deletes profiles and chooses the default
+one. Edits keep the comments and formatting of the configuration file.`,
+}
+
+// profileListCmd represents the profile list command
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the configured profiles",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		loader := newConfigLoader()
+		profiles, err := loader.Profiles()
+		if err != nil {
+			logger.Fatal("error loading config: %v", err)
+		}
+		selected, _ := loader.SelectedProfile()
+		for _, profile := range profiles {
+			marker := " "
+			if profile == selected {
+				marker = "*"
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", marker, profile)
+		}
+	},
+}
+
+// profileCreateCmd represents the profile create command
+var profileCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create a profile",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ed := openUserConfig()
+		if err := ed.AddSection(args[0]); err != nil {
+			logger.Fatal("%v", err)
+		}
+		if profileURL != "" {
+			ed.Set(args[0], "url", profileURL)
+		}
+		if profileClientID != "" {
+			ed.Set(args[0], "client-id", profileClientID)
+		}
+		saveUserConfig(ed)
+		logger.Info("Profile %s created", args[0])
+	},
+}
+
+// profileRenameCmd represents the profile rename command
+var profileRenameCmd = &cobra.Command{
+	Use:   "rename <old> <new>",
+	Short: "Rename a profile and its stored token",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ed := openUserConfig()
+		if err := ed.RenameSection(args[0], args[1]); err != nil {
+			logger.Fatal("%v", err)
+		}
+		if isDefaultProfile(ed, args[0]) {
+			ed.Set("", "default-profile", args[1])
+		}
+		saveUserConfig(ed)
+
+		ts, err := initializeTokenStore()
+		if err != nil {
+			logger.Fatal("Token store setup failed: %v", err)
+		}
+		if token, err := ts.GetToken(args[0]); err == nil && token != nil {
+			token.Profile = args[1]
+			if err := ts.AddToken(token); err != nil {
+				logger.Fatal("failed to move token: %v", err)
+			}
+			if err := ts.RemoveToken(args[0]); err != nil {
+				logger.Fatal("failed to move token: %v", err)
+			}
+		}
+		logger.Info("Profile %s renamed to %s", args[0], args[1])
+		logger.Warn("SSH keys are named after the profile, run magic-auth and generate-ssh-config for %s", args[1])
+	},
+}
+
+// profileCopyCmd represents the profile copy command
+var profileCopyCmd = &cobra.Command{
+	Use:   "copy <source> <name>",
+	Short: "Copy a profile under a new name",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ed := openUserConfig()
+		if err := ed.CopySection(args[0], args[1]); err != nil {
+			logger.Fatal("%v", err)
+		}
+		saveUserConfig(ed)
+		logger.Info("Profile %s copied to %s", args[0], args[1])
+	},
+}
+
+// profileDeleteCmd represents the profile delete command
+var profileDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a profile and its stored token",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ed := openUserConfig()
+		if err := ed.DeleteSection(args[0]); err != nil {
+			logger.Fatal("%v", err)
+		}
+		if isDefaultProfile(ed, args[0]) {
+			ed.Unset("", "default-profile")
+		}
+		saveUserConfig(ed)
+
+		ts, err := initializeTokenStore()
+		if err != nil {
+			logger.Fatal("Token store setup failed: %v", err)
+		}
+		if token, err := ts.GetToken(args[0]); err == nil && token != nil {
+			err := ts.RemoveToken(args[0])
+			recordAudit(nil, nil, audit.Event{Action: audit.ActionTokenRemove, Profile: args[0], Detail: "profile deleted"}, err)
+			if err != nil {
+				logger.Warn("failed to remove token: %v", err)
+			}
+		}
+		logger.Info("Profile %s deleted", args[0])
+	},
+}
+
+// profileDefaultCmd represents the profile default command
+var profileDefaultCmd = &cobra.Command{
+	Use:   "default <name>",
+	Short: "Choose the profile used when --profile is not given",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ed := openUserConfig()
+		if !ed.HasSection(args[0]) {
+			logger.Fatal("No profile named %s", args[0])
+		}
+		ed.Set("", "default-profile", args[0])
+		saveUserConfig(ed)
+		logger.Info("Default profile set to %s", args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileListCmd)
+	profileCmd.AddCommand(profileCreateCmd)
+	profileCmd.AddCommand(profileRenameCmd)
+	profileCmd.AddCommand(profileCopyCmd)
+	profileCmd.AddCommand(profileDeleteCmd)
+	profileCmd.AddCommand(profileDefaultCmd)
+
+	profileCreateCmd.Flags().StringVar(&profileURL, "url", "", "URL of the GitLab instance")
+	profileCreateCmd.Flags().StringVar(&profileClientID, "client-id", "", "GitLab application client ID")
+}
+
+// openUserConfig opens the user configuration file for editing
+func openUserConfig() *config.Editor {
+	ed, err := config.OpenEditor(newConfigLoader().UserFile())
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+	return ed
+}
+
+// saveUserConfig writes the edited user configuration file
+func saveUserConfig(ed *config.Editor) {
+	if err := ed.SaveWith(fileWriter); err != nil {
+		logger.Fatal("failed to save configuration: %v", err)
+	}
+}
+
+// isDefaultProfile reports whether the top-level default-profile of the file names the
+// profile, whatever the quoting of the value
+func isDefaultProfile(ed *config.Editor, profile string) bool {
+	raw, ok := ed.Get("", "default-profile")
+	if !ok {
+		return false
+	}
+	value, err := config.DecodeValue(raw)
+	return err == nil && value == profile
+}
@@ -0,0 +1,202 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/atnomoverflow/git-auth/pkg/audit"
+	"github.com/atnomoverflow/git-auth/pkg/config"
+	"github.com/atnomoverflow/git-auth/pkg/gitlab"
+	tokenstore "github.com/atnomoverflow/git-auth/pkg/token-store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	allProfilesFlag bool
+	profilesFlag    []string
+	parallelFlag    int
+
+	// deviceFlowMu makes concurrent profiles prompt for their device flow one at a time
+	deviceFlowMu sync.Mutex
+
+	notLoggedInError = errors.New("User not logged in!")
+)
+
+// profileWorkflow runs a command for one profile and returns a short summary
+type profileWorkflow func(cfg *config.Config, glc *gitlab.GitlabClient, ts *tokenstore.TokenStore) (string, error)
+
+// profileResult is the outcome of a workflow for one profile
+type profileResult struct {
+	profile string
+	summary string
+	err     error
+}
+
+// addProfilesFlags registers the flags selecting several profiles on a command
+func addProfilesFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&allProfilesFlag, "all-profiles", false, "Run for every configured profile")
+	cmd.Flags().StringSliceVar(&profilesFlag, "profiles", nil, "Run for the given comma separated profiles")
+	cmd.Flags().IntVar(&parallelFlag, "parallel", 4, "Number of profiles processed at the same time")
+	cmd.MarkFlagsMutuallyExclusive("all-profiles", "profiles")
+}
+
+// runForProfiles runs the workflow for the selected profile, or concurrently for
+// every profile given by --all-profiles or --profiles followed by a summary table on out
+func runForProfiles(out io.Writer, workflow profileWorkflow) {
+	ts, err := initializeTokenStore()
+	if err != nil {
+		logger.Fatal("Token store setup failed: %v", err)
+	}
+
+	if !multipleProfiles() {
+		cfg, glc, err := initializeConfigAndGitLabClient()
+		if err != nil {
+			logger.Fatal("Initialization failed: %v", err)
+		}
+		summary, err := workflow(cfg, glc, ts)
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+		logger.Info("%s", summary)
+		return
+	}
+
+	loader := newConfigLoader()
+	profiles, err := selectedProfiles(loader)
+	if err != nil {
+		logger.Fatal("error loading config: %v", err)
+	}
+
+	results := make([]profileResult, len(profiles))
+	inParallel(len(profiles), func(i int) {
+		results[i] = profileResult{profile: profiles[i]}
+		cfg, err := loader.LoadProfile(profiles[i])
+		if err != nil {
+			results[i].err = fmt.Errorf("error loading config: %w", err)
+			return
+		}
+		results[i].summary, results[i].err = workflow(cfg, newGitlabClient(cfg), ts)
+	})
+
+	failed := 0
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROFILE\tSTATUS\tDETAIL")
+	for _, result := range results {
+		status, detail := "ok", result.summary
+		if result.err != nil {
+			failed++
+			status, detail = "failed", result.err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", result.profile, status, strings.ReplaceAll(detail, "\n", " "))
+	}
+	w.Flush()
+	if failed > 0 {
+		logger.Fatal("%d of %d profiles failed", failed, len(results))
+	}
+}
+
+// multipleProfiles reports whether --all-profiles or --profiles was given
+func multipleProfiles() bool {
+	return allProfilesFlag || len(profilesFlag) > 0
+}
+
+// selectedProfiles returns the profiles given by --all-profiles or --profiles
+func selectedProfiles(loader *config.Loader) ([]string, error) {
+	if allProfilesFlag {
+		return loader.Profiles()
+	}
+	return profilesFlag, nil
+}
+
+// inParallel calls fn for every index below n, --parallel calls at a time
+func inParallel(n int, fn func(i int)) {
+	if parallelFlag < 1 {
+		parallelFlag = 1
+	}
+	slots := make(chan struct{}, parallelFlag)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			fn(i)
+		}()
+	}
+	wg.Wait()
+}
+
+// authenticate returns a valid token for the profile, starting the device flow
+// when the user is not logged in or the token cannot be refreshed
+func authenticate(cfg *config.Config, glc *gitlab.GitlabClient, ts *tokenstore.TokenStore) (*tokenstore.Token, error) {
+	token, err := validateOrRefreshToken(ts, cfg, glc)
+	if err != tokenstore.TokenNotFound && err != gitlab.RefreshTokenFailedError {
+		return token, err
+	}
+
+	if fileWriter.DryRun() {
+		return nil, fmt.Errorf("profile %s is not logged in, run without --dry-run to log in", cfg.Profile)
+	}
+	deviceFlowMu.Lock()
+	defer deviceFlowMu.Unlock()
+	// the prompt goes to stderr whatever the log settings, the login waits for it
+	newToken, err := glc.DeviceFlow(func(resp *gitlab.DeviceFlowResp) {
+		fmt.Fprintf(os.Stderr, "Logging in profile %s to %s\n", cfg.Profile, cfg.URL)
+		gitlab.PrintDevicePrompt(os.Stderr, resp)
+	})
+	if err != nil {
+		recordAudit(cfg, nil, audit.Event{Action: audit.ActionLogin}, err)
+		return nil, err
+	}
+	recordAudit(cfg, glc, audit.Event{Action: audit.ActionLogin}, nil)
+	logger.AddSecret(newToken.AccessToken, newToken.RefreshToken)
+	updatedToken := &tokenstore.Token{
+		Profile:      cfg.Profile,
+		Token:        newToken.AccessToken,
+		RefreshToken: newToken.RefreshToken,
+		ExpireAt:     expiryTime(newToken.ExpiresIn),
+	}
+	if err := ts.AddToken(updatedToken); err != nil {
+		logger.Warn("error saving updated token: %v", err)
+	}
+	return updatedToken, nil
+}
+
+// requireLogin returns a valid token for the profile without starting a new login
+func requireLogin(cfg *config.Config, glc *gitlab.GitlabClient, ts *tokenstore.TokenStore) (*tokenstore.Token, error) {
+	token, err := validateOrRefreshToken(ts, cfg, glc)
+	if err == tokenstore.TokenNotFound || err == gitlab.RefreshTokenFailedError {
+		return nil, notLoggedInError
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unexpected error: %w", err)
+	}
+	return token, nil
+}
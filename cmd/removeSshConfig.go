@@ -0,0 +1,82 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/atnomoverflow/git-auth/pkg/audit"
+	"github.com/atnomoverflow/git-auth/pkg/config"
+	"github.com/atnomoverflow/git-auth/pkg/gitlab"
+	tokenstore "github.com/atnomoverflow/git-auth/pkg/token-store"
+	"github.com/spf13/cobra"
+)
+
+// removeSshConfigCmd represents the remove-ssh-config command
+var removeSshConfigCmd = &cobra.Command{
+	Use:   "remove-ssh-config",
+	Short: "Remove the SSH config generated for a profile",
+	Long: `This command removes the Host block generate-ssh-config wrote for the profile from the managed
+SSH config file, and the block older versions wrote to ~/.ssh/config. When the last block
+is removed the managed file is deleted and its Include line dropped from ~/.ssh/config.
+The url rewrites of the profile namespaces to its alias are removed from the global git config.
+
+Use --all to remove the blocks of every profile and --dry-run to only show what would be removed.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runForProfiles(cmd.OutOrStdout(), func(cfg *config.Config, glc *gitlab.GitlabClient, ts *tokenstore.TokenStore) (string, error) {
+			return removeSSHConfig(cfg, glc)
+		})
+	},
+}
+
+// removeSSHConfig removes the Host block of the profile and records the edit
+func removeSSHConfig(cfg *config.Config, glc *gitlab.GitlabClient) (string, error) {
+	sshManager := newSSHManager(cfg)
+	// the url rewrites would point to a Host that no longer exists
+	if _, err := removeURLRewrites(cfg, glc); err != nil {
+		return "", err
+	}
+	removed, err := sshManager.RemoveSSHConfig()
+	if err == nil && !removed {
+		return fmt.Sprintf("no SSH config for Host %s", cfg.SSHAlias), nil
+	}
+	if err == nil && fileWriter.DryRun() {
+		return fmt.Sprintf("would remove Host %s from %s", cfg.SSHAlias, sshManager.ConfigFile()), nil
+	}
+	recordAudit(cfg, glc, audit.Event{
+		Action: audit.ActionSSHConfigEdit,
+		Path:   sshManager.ConfigFile(),
+		Detail: fmt.Sprintf("removed Host %s", cfg.SSHAlias),
+	}, err)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("removed Host %s from %s", cfg.SSHAlias, sshManager.ConfigFile()), nil
+}
+
+func init() {
+	rootCmd.AddCommand(removeSshConfigCmd)
+	addProfilesFlags(removeSshConfigCmd)
+	removeSshConfigCmd.Flags().BoolVar(&allProfilesFlag, "all", false, "Remove the SSH config of every profile, like --all-profiles")
+	removeSshConfigCmd.MarkFlagsMutuallyExclusive("all", "profiles")
+}
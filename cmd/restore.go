@@ -0,0 +1,87 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/atnomoverflow/git-auth/pkg/files"
+	"github.com/spf13/cobra"
+)
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore [backup]",
+	Short: "Undo the file changes of a previous command",
+	Long: `Before changing the SSH config, known_hosts, keys, tokens, the git config or the configuration file,
+git-auth keeps a copy of the originals in ~/.git-auth/backups, one directory per command.
+Keys and tokens are not copied, and only the 20 most recent backups are kept.
+
+Without arguments this command lists the backups. Given the id of a backup, it puts the
+files back as they were before that command and removes the files it created. The
+current files are backed up first, so a restore can be undone too. Use --dry-run to see
+the changes without making them.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, err := backupDir()
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+		if len(args) == 0 {
+			backups, err := files.ListBackups(dir)
+			if err != nil {
+				logger.Fatal("%v", err)
+			}
+			if len(backups) == 0 {
+				logger.Info("No backups in %s", dir)
+				return
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tTIME\tFILES\tCOMMAND")
+			for _, b := range backups {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", b.ID, b.Time.Local().Format("2006-01-02 15:04:05"), b.Restorable(), b.Command)
+			}
+			w.Flush()
+			return
+		}
+
+		backup, err := files.OpenBackup(dir, args[0])
+		if errors.Is(err, files.ErrBackupNotFound) {
+			logger.Fatal("No backup %s, list them with git-auth restore", args[0])
+		}
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+		if err := fileWriter.Restore(backup); err != nil {
+			logger.Fatal("Restore failed: %v", err)
+		}
+		if !fileWriter.DryRun() {
+			logger.Info("Restored %d files from backup %s", backup.Restorable(), backup.ID)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+}
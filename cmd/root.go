@@ -22,34 +22,68 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/atnomoverflow/git-auth/pkg/audit"
 	"github.com/atnomoverflow/git-auth/pkg/config"
+	"github.com/atnomoverflow/git-auth/pkg/files"
 	"github.com/atnomoverflow/git-auth/pkg/gitlab"
 	l "github.com/atnomoverflow/git-auth/pkg/logger"
+	"github.com/atnomoverflow/git-auth/pkg/ssh"
 	tokenstore "github.com/atnomoverflow/git-auth/pkg/token-store"
+	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // rootCmd represents the base command when called without any subcommands
 var (
-	logger  = l.New(l.DEBUG)
-	rootCmd = &cobra.Command{
+	logger = l.New(l.INFO)
+	// fileWriter changes every file git-auth writes, backing them up or printing a diff with --dry-run
+	fileWriter = files.New()
+	rootCmd    = &cobra.Command{
 		Use:   "git-auth",
 		Short: "A simple CLI to manage SSH keys for gitlab",
 		Long: `git-auth is CLI library that helps manage SSH for gitlab.
 It genrate an ssh and adds it to your gitlab account. 
 It also delete any expired key that was created by the cli.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := setupLogger(); err != nil {
+				return err
+			}
+			if err := checkSetFlag(); err != nil {
+				return err
+			}
+			return setupFileWriter()
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			if backup := fileWriter.Backup(); backup != nil {
+				logger.Info("Previous versions of %d files saved, undo with: git-auth restore %s", backup.Restorable(), backup.ID)
+			}
+		},
 		// Uncomment the following line if your bare application
 		// has an action associated with it:
 		// Run: func(cmd *cobra.Command, args []string) { },
 	}
 )
 
+var (
+	profileFlag   string
+	configFlag    string
+	logLevelFlag  string
+	logFormatFlag string
+	logFileFlag   string
+	quietFlag     bool
+	redactFlag    []string
+	dryRunFlag    bool
+	setFlag       []string
+)
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -60,27 +94,154 @@ func Execute() {
 }
 
 func init() {
-	rootCmd.PersistentFlags().StringP("profile", "p", "", "profile to be used")
-	viper.BindPFlag("profile", rootCmd.PersistentFlags().Lookup("profile"))
+	rootCmd.PersistentFlags().StringVarP(&profileFlag, "profile", "p", "", "profile to be used")
+	rootCmd.PersistentFlags().StringVar(&configFlag, "config", "", "configuration file to use instead of the user one")
+	rootCmd.PersistentFlags().StringVar(&logLevelFlag, "log-level", "info", "log level: debug, info, warn, error or fatal")
+	rootCmd.PersistentFlags().StringVar(&logFormatFlag, "log-format", "console", "log format: console or json")
+	rootCmd.PersistentFlags().StringVar(&logFileFlag, "log-file", "", "write logs to this file instead of stderr")
+	rootCmd.PersistentFlags().BoolVarP(&quietFlag, "quiet", "q", false, "only log errors")
+	rootCmd.PersistentFlags().StringArrayVar(&redactFlag, "redact", nil, "regular expression of extra secrets to mask in the logs, can be repeated")
+	rootCmd.PersistentFlags().BoolVar(&dryRunFlag, "dry-run", false, "show the changes to files as diffs without writing them")
+	rootCmd.PersistentFlags().StringArrayVar(&setFlag, "set", nil, "set a key of the selected profile for this run, as key=value, can be repeated")
+}
+
+// checkSetFlag rejects --set values that are not key=value with a known key
+func checkSetFlag() error {
+	for _, item := range setFlag {
+		key, _, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("invalid --set %q, expected key=value", item)
+		}
+		if !isProfileKey(key) {
+			return fmt.Errorf("invalid --set %q, unknown key %s", item, key)
+		}
+	}
+	return nil
+}
+
+// setupLogger replaces the logger according to the logging flags. Logs go to stderr
+// so the output of the commands on stdout can be consumed by scripts. Colors are
+// only used on a terminal and when NO_COLOR is not set.
+func setupLogger() error {
+	var lvl l.LogLevel
+	if err := lvl.SetValue(logLevelFlag); err != nil {
+		return err
+	}
+	if quietFlag {
+		lvl = l.ERROR
+	}
+	var format l.Format
+	if err := format.SetValue(logFormatFlag); err != nil {
+		return err
+	}
+
+	out := os.Stderr
+	if logFileFlag != "" {
+		f, err := os.OpenFile(logFileFlag, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		out = f
+	}
+	redactor := l.NewRedactor()
+	for _, pattern := range redactFlag {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid redact pattern %q: %w", pattern, err)
+		}
+		redactor.AddPattern(re)
+	}
+
+	_, noColor := os.LookupEnv("NO_COLOR")
+	color := !noColor && (isatty.IsTerminal(out.Fd()) || isatty.IsCygwinTerminal(out.Fd()))
+
+	logger = l.New(lvl, l.WithOutput(out), l.WithFormat(format), l.WithColor(color), l.WithRedactor(redactor))
+	return nil
+}
+
+// setupFileWriter creates the writer of the command, keeping backups in ~/.git-auth/backups
+func setupFileWriter() error {
+	dir, err := backupDir()
+	if err != nil {
+		return err
+	}
+	command := logger.Redact(strings.Join(append([]string{"git-auth"}, os.Args[1:]...), " "))
+	fileWriter = files.New(
+		files.WithDryRun(dryRunFlag),
+		files.WithBackupDir(dir, command),
+		files.WithLogger(logger),
+	)
+	return nil
+}
+
+// backupDir returns the directory holding the backups of changed files
+func backupDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(home, ".git-auth", "backups"), nil
+}
 
+// newConfigLoader creates the configuration loader honoring the global flags
+func newConfigLoader() *config.Loader {
+	options := []config.LoaderOptions{
+		config.WithLogger(logger),
+		config.WithConfigFile(configFlag),
+		config.WithProfile(profileFlag),
+	}
+	for _, item := range setFlag {
+		key, value, _ := strings.Cut(item, "=")
+		options = append(options, config.WithOverride(key, value))
+	}
+	return config.NewLoader(options...)
 }
 
 // initializeConfigAndGitLabClient loads the configuration and initializes the GitLab client
 func initializeConfigAndGitLabClient() (*config.Config, *gitlab.GitlabClient, error) {
-	cfg, err := config.LoadConfig(*logger)
+	cfg, err := newConfigLoader().Load()
 	if err != nil {
 		return nil, nil, fmt.Errorf("error loading config: %w", err)
 	}
 
-	glc := gitlab.New(
+	return cfg, newGitlabClient(cfg), nil
+}
+
+// newGitlabClient initializes the GitLab client of a profile
+func newGitlabClient(cfg *config.Config) *gitlab.GitlabClient {
+	return gitlab.New(
 		cfg.URL,
-		logger,
+		gitlab.WithLogger(logger),
 		gitlab.WithClientId(cfg.ClientID),
 		gitlab.WithScope(cfg.Scope),
 		gitlab.WithSshPrefix(cfg.SSHPrefix),
 	)
+}
 
-	return cfg, glc, nil
+// newSSHManager initializes the SSH manager of a profile
+func newSSHManager(cfg *config.Config) *ssh.SSHManager {
+	return ssh.New(
+		cfg.SSHHost,
+		ssh.WithKeyName(cfg.Profile),
+		ssh.WithPath(cfg.SSHPath),
+		ssh.WithPort(cfg.SSHPort),
+		ssh.WithKnownHostsFile(cfg.KnownHostsFile),
+		ssh.WithConfigFile(cfg.SSHConfigFile),
+		ssh.WithHostOptions(ssh.HostOptions{
+			Alias:          cfg.SSHAlias,
+			User:           cfg.SSHUser,
+			IdentitiesOnly: cfg.IdentitiesOnly,
+			IdentityAgent:  cfg.IdentityAgent,
+			ProxyJump:      cfg.ProxyJump,
+			ControlMaster:  cfg.ControlMaster,
+			ControlPersist: cfg.ControlPersist,
+			HostKeyAlias:   cfg.HostKeyAlias,
+			Extra:          cfg.SSHOptions,
+			Template:       cfg.SSHConfigTemplate,
+		}),
+		ssh.WithLogger(logger),
+		ssh.WithWriter(fileWriter),
+	)
 }
 
 // initializeTokenStore sets up the token store
@@ -91,7 +252,7 @@ func initializeTokenStore() (*tokenstore.TokenStore, error) {
 	}
 
 	configDir := filepath.Join(home, ".git-auth")
-	ts := tokenstore.New(configDir)
+	ts := tokenstore.New(configDir, tokenstore.WithWriter(fileWriter))
 	return ts, nil
 }
 
@@ -104,6 +265,7 @@ func validateOrRefreshToken(ts *tokenstore.TokenStore, cfg *config.Config, glc *
 	if token == nil {
 		return nil, tokenstore.TokenNotFound
 	}
+	logger.AddSecret(token.Token, token.RefreshToken)
 
 	isValid, err := glc.VerifyToken(token.Token)
 	if err != nil {
@@ -115,24 +277,44 @@ func validateOrRefreshToken(ts *tokenstore.TokenStore, cfg *config.Config, glc *
 		glc.SetToken(token.Token)
 		return token, nil
 	}
+	return refreshStoredToken(ts, cfg, glc, token)
+}
 
+// expiryTime returns the Unix time a token lasting expiresIn seconds expires at, 0 for a
+// token without expiry
+func expiryTime(expiresIn int64) int64 {
+	if expiresIn <= 0 {
+		return 0
+	}
+	return time.Now().Unix() + expiresIn
+}
+
+// refreshStoredToken replaces the stored token of the profile with a new one obtained
+// from its refresh token
+func refreshStoredToken(ts *tokenstore.TokenStore, cfg *config.Config, glc *gitlab.GitlabClient, token *tokenstore.Token) (*tokenstore.Token, error) {
+	// GitLab rotates the refresh token, so a refresh that is not saved logs the user out
+	if fileWriter.DryRun() {
+		return nil, errors.New("the token has expired, run without --dry-run to refresh it")
+	}
 	newToken, err := glc.RefreshToken(token.RefreshToken)
 	if err != nil {
+		recordAudit(cfg, nil, audit.Event{Action: audit.ActionTokenRefresh}, err)
 		logger.Debug("token refresh failed; please login using the auth command: %w", err)
 		return nil, gitlab.RefreshTokenFailedError
 	}
 
-	expireAt := time.Now().Unix() + newToken.ExpiresIn
+	logger.AddSecret(newToken.AccessToken, newToken.RefreshToken)
 	updatedToken := &tokenstore.Token{
 		Profile:      cfg.Profile,
 		Token:        newToken.AccessToken,
 		RefreshToken: newToken.RefreshToken,
-		ExpireAt:     expireAt,
+		ExpireAt:     expiryTime(newToken.ExpiresIn),
 	}
 	if err := ts.AddToken(updatedToken); err != nil {
 		return nil, fmt.Errorf("error saving updated token: %w", err)
 	}
 
 	glc.SetToken(newToken.AccessToken)
+	recordAudit(cfg, glc, audit.Event{Action: audit.ActionTokenRefresh}, nil)
 	return updatedToken, nil
 }
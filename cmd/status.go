@@ -0,0 +1,394 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/atnomoverflow/git-auth/pkg/config"
+	"github.com/atnomoverflow/git-auth/pkg/gitlab"
+	"github.com/atnomoverflow/git-auth/pkg/ssh"
+	tokenstore "github.com/atnomoverflow/git-auth/pkg/token-store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	statusOutput  string
+	statusOffline bool
+)
+
+// profileStatus is the identity report of a profile
+type profileStatus struct {
+	Profile        string     `json:"profile"`
+	URL            string     `json:"url"`
+	LoggedIn       bool       `json:"logged_in"`
+	User           string     `json:"user,omitempty"`
+	Name           string     `json:"name,omitempty"`
+	TokenExpiresAt *time.Time `json:"token_expires_at,omitempty"`
+	Scopes         []string   `json:"scopes,omitempty"`
+	Key            *keyStatus `json:"key,omitempty"`
+	SSHConfig      bool       `json:"ssh_config"`
+	// CheckedAt is when the GitLab data was fetched, Cached is set when it
+	// comes from an earlier run
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	Cached    bool       `json:"cached"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// keyStatus describes the local key of a profile and its registration on GitLab
+type keyStatus struct {
+	Path        string `json:"path"`
+	Type        string `json:"type"`
+	Fingerprint string `json:"fingerprint"`
+	// Registered is unset when it could not be checked
+	Registered *bool      `json:"registered,omitempty"`
+	KeyID      int        `json:"key_id,omitempty"`
+	Title      string     `json:"title,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:     "status",
+	Aliases: []string{"whoami"},
+	Short:   "Show the GitLab identity, token and SSH key of profiles",
+	Long: `This command reports, for the selected profile or for each profile given by --all-profiles
+or --profiles, the logged-in GitLab user, the expiry and scopes of the token, the local key
+with its type and fingerprint, whether that key is registered on GitLab and when it expires,
+and whether the SSH config block exists.
+
+Each online run is cached in ~/.git-auth/status.json. With --offline nothing is requested
+from GitLab: the local checks are run and the GitLab data is read from the cache.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if statusOutput != "table" && statusOutput != "json" {
+			logger.Fatal("unknown output %q, choose between table and json", statusOutput)
+		}
+		ts, err := initializeTokenStore()
+		if err != nil {
+			logger.Fatal("Token store setup failed: %v", err)
+		}
+		cachePath, err := statusCachePath()
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+		cache, err := readStatusCache(cachePath)
+		if err != nil {
+			logger.Warn("ignoring the status cache: %v", err)
+			cache = map[string]profileStatus{}
+		}
+
+		var configs []*config.Config
+		if !multipleProfiles() {
+			cfg, err := newConfigLoader().Load()
+			if err != nil {
+				logger.Fatal("error loading config: %v", err)
+			}
+			configs = append(configs, cfg)
+		} else {
+			loader := newConfigLoader()
+			profiles, err := selectedProfiles(loader)
+			if err != nil {
+				logger.Fatal("error loading config: %v", err)
+			}
+			for _, profile := range profiles {
+				cfg, err := loader.LoadProfile(profile)
+				if err != nil {
+					logger.Fatal("error loading config of %s: %v", profile, err)
+				}
+				configs = append(configs, cfg)
+			}
+		}
+
+		statuses := make([]profileStatus, len(configs))
+		inParallel(len(configs), func(i int) {
+			cfg := configs[i]
+			if statusOffline {
+				statuses[i] = offlineStatus(cfg, ts, cache[cfg.Profile])
+			} else {
+				statuses[i] = onlineStatus(cfg, newGitlabClient(cfg), ts)
+			}
+		})
+
+		if !statusOffline {
+			for _, status := range statuses {
+				if status.Error == "" {
+					cache[status.Profile] = status
+				}
+			}
+			if err := writeStatusCache(cachePath, cache); err != nil {
+				logger.Warn("failed to update the status cache: %v", err)
+			}
+		}
+
+		out := cmd.OutOrStdout()
+		if statusOutput == "json" {
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(statuses); err != nil {
+				logger.Fatal("failed to encode status: %v", err)
+			}
+		} else {
+			printStatuses(out, statuses)
+		}
+		for _, status := range statuses {
+			if status.Error != "" {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+// localStatus fills in what can be checked without GitLab
+func localStatus(cfg *config.Config) profileStatus {
+	status := profileStatus{Profile: cfg.Profile, URL: cfg.URL}
+	sshManager := newSSHManager(cfg)
+	if key, err := sshManager.LocalKey(); err == nil {
+		status.Key = &keyStatus{Path: key.Path, Type: key.Type, Fingerprint: key.Fingerprint}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		logger.Warn("%s: %v", cfg.Profile, err)
+	}
+	hasConfig, err := sshManager.HasSSHConfig()
+	if err != nil {
+		logger.Warn("%s: %v", cfg.Profile, err)
+	}
+	status.SSHConfig = hasConfig
+	return status
+}
+
+// onlineStatus asks GitLab about the token and the keys of the profile
+func onlineStatus(cfg *config.Config, glc *gitlab.GitlabClient, ts *tokenstore.TokenStore) profileStatus {
+	status := localStatus(cfg)
+	now := time.Now().UTC().Truncate(time.Second)
+	status.CheckedAt = &now
+
+	token, err := validateOrRefreshToken(ts, cfg, glc)
+	if err == tokenstore.TokenNotFound || err == gitlab.RefreshTokenFailedError {
+		return status
+	}
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.LoggedIn = true
+
+	user, err := glc.GetUser(token.Token)
+	if err != nil {
+		status.Error = fmt.Sprintf("failed to get user: %v", err)
+		return status
+	}
+	status.User, status.Name = user.Username, user.Name
+
+	info, err := glc.GetTokenInfo(token.Token)
+	if err != nil {
+		status.Error = fmt.Sprintf("failed to get token info: %v", err)
+		return status
+	}
+	if expiresAt, ok := info.ExpiresAt(); ok {
+		expiresAt = expiresAt.UTC().Truncate(time.Second)
+		status.TokenExpiresAt = &expiresAt
+	}
+	status.Scopes = info.Scope
+
+	if status.Key == nil {
+		return status
+	}
+	keys, err := glc.ListSSHKeys()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	registered := false
+	for _, key := range keys {
+		publicKey, _ := key["key"].(string)
+		if fingerprint, err := ssh.Fingerprint(publicKey); err != nil || fingerprint != status.Key.Fingerprint {
+			continue
+		}
+		registered = true
+		if id, ok := key["id"].(float64); ok {
+			status.Key.KeyID = int(id)
+		}
+		status.Key.Title, _ = key["title"].(string)
+		if raw, ok := key["expires_at"].(string); ok && raw != "" {
+			if expires, err := time.Parse(time.RFC3339, raw); err == nil {
+				status.Key.ExpiresAt = &expires
+			}
+		}
+		break
+	}
+	status.Key.Registered = &registered
+	return status
+}
+
+// offlineStatus combines the local checks with the cached GitLab data. The
+// registration of a key is only reused when the local key did not change.
+func offlineStatus(cfg *config.Config, ts *tokenstore.TokenStore, cached profileStatus) profileStatus {
+	status := localStatus(cfg)
+	if token, err := ts.GetToken(cfg.Profile); err == nil && token != nil {
+		// a token without expiry is valid until revoked, which only GitLab knows
+		status.LoggedIn = token.ExpireAt == 0 || time.Now().Unix() < token.ExpireAt
+		if token.ExpireAt > 0 {
+			expiresAt := time.Unix(token.ExpireAt, 0).UTC()
+			status.TokenExpiresAt = &expiresAt
+		}
+	}
+	if cached.CheckedAt == nil {
+		return status
+	}
+	status.Cached = true
+	status.CheckedAt = cached.CheckedAt
+	status.User, status.Name, status.Scopes = cached.User, cached.Name, cached.Scopes
+	if status.Key != nil && cached.Key != nil && cached.Key.Fingerprint == status.Key.Fingerprint {
+		status.Key.Registered = cached.Key.Registered
+		status.Key.KeyID = cached.Key.KeyID
+		status.Key.Title = cached.Key.Title
+		status.Key.ExpiresAt = cached.Key.ExpiresAt
+	}
+	return status
+}
+
+func printStatuses(out io.Writer, statuses []profileStatus) {
+	for i, status := range statuses {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "Profile:\t%s (%s)\n", status.Profile, status.URL)
+		switch {
+		case !status.LoggedIn:
+			fmt.Fprintf(w, "User:\tnot logged in\n")
+		case status.User == "":
+			fmt.Fprintf(w, "User:\tunknown\n")
+		default:
+			fmt.Fprintf(w, "User:\t%s (%s)\n", status.User, status.Name)
+		}
+		if status.TokenExpiresAt != nil {
+			fmt.Fprintf(w, "Token expires:\t%s\n", formatExpiry(*status.TokenExpiresAt))
+		}
+		if len(status.Scopes) > 0 {
+			fmt.Fprintf(w, "Scopes:\t%s\n", strings.Join(status.Scopes, " "))
+		}
+		if status.Key == nil {
+			fmt.Fprintf(w, "Key:\tnone\n")
+		} else {
+			fmt.Fprintf(w, "Key:\t%s (%s %s)\n", status.Key.Path, status.Key.Type, status.Key.Fingerprint)
+			switch {
+			case status.Key.Registered == nil:
+				fmt.Fprintf(w, "Registered:\tunknown\n")
+			case !*status.Key.Registered:
+				fmt.Fprintf(w, "Registered:\tno\n")
+			default:
+				expiry := "never expires"
+				if status.Key.ExpiresAt != nil {
+					expiry = "expires " + formatExpiry(*status.Key.ExpiresAt)
+				}
+				fmt.Fprintf(w, "Registered:\tyes, %s (id %d), %s\n", status.Key.Title, status.Key.KeyID, expiry)
+			}
+		}
+		fmt.Fprintf(w, "SSH config:\t%s\n", yesNo(status.SSHConfig))
+		if status.Cached {
+			fmt.Fprintf(w, "GitLab data:\tcached at %s\n", status.CheckedAt.Local().Format("2006-01-02 15:04"))
+		} else if statusOffline {
+			fmt.Fprintf(w, "GitLab data:\tnot cached\n")
+		}
+		if status.Error != "" {
+			fmt.Fprintf(w, "Error:\t%s\n", status.Error)
+		}
+		w.Flush()
+	}
+}
+
+func formatExpiry(t time.Time) string {
+	left := time.Until(t).Round(time.Minute)
+	if left < 0 {
+		return fmt.Sprintf("%s (expired)", t.Local().Format("2006-01-02 15:04"))
+	}
+	return fmt.Sprintf("%s (in %s)", t.Local().Format("2006-01-02 15:04"), humanDuration(left))
+}
+
+// humanDuration rounds d to days, hours or minutes
+func humanDuration(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	default:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func statusCachePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(home, ".git-auth", "status.json"), nil
+}
+
+func readStatusCache(path string) (map[string]profileStatus, error) {
+	cache := map[string]profileStatus{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return cache, nil
+}
+
+func writeStatusCache(path string, cache map[string]profileStatus) error {
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	addProfilesFlags(statusCmd)
+	statusCmd.Flags().StringVarP(&statusOutput, "output", "o", "table", "output format: table or json")
+	statusCmd.Flags().BoolVar(&statusOffline, "offline", false, "do not contact GitLab, use the cached data")
+}
@@ -0,0 +1,96 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/atnomoverflow/git-auth/pkg/gitlab"
+	tokenstore "github.com/atnomoverflow/git-auth/pkg/token-store"
+	"github.com/spf13/cobra"
+)
+
+var tokenJSON bool
+
+// tokenCmd represents the token command
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Print a valid GitLab access token for scripting",
+	Long: `This command prints a valid access token for the selected profile on stdout, refreshing it
+if needed. Logs are written to stderr so the output can be captured directly:
+
+  curl -H "Authorization: Bearer $(git-auth token)" https://gitlab.example.com/api/v4/user
+
+With --json it prints the token together with its expiry and scopes.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, glc, err := initializeConfigAndGitLabClient()
+		if err != nil {
+			logger.Fatal("Initialization failed: %v", err)
+		}
+		ts, err := initializeTokenStore()
+		if err != nil {
+			logger.Fatal("Token store setup failed: %v", err)
+		}
+		token, err := validateOrRefreshToken(ts, cfg, glc)
+		if err == tokenstore.TokenNotFound || err == gitlab.RefreshTokenFailedError {
+			logger.Fatal("User not logged in!")
+		}
+		if err != nil {
+			logger.Fatal("unexpected error: %v", err)
+		}
+
+		if !tokenJSON {
+			fmt.Fprintln(cmd.OutOrStdout(), token.Token)
+			return
+		}
+		info, err := glc.GetTokenInfo(token.Token)
+		if err != nil {
+			logger.Fatal("failed to get token info: %v", err)
+		}
+		out := struct {
+			Profile   string     `json:"profile"`
+			Token     string     `json:"token"`
+			ExpiresAt *time.Time `json:"expires_at"`
+			Scopes    []string   `json:"scopes"`
+		}{
+			Profile: cfg.Profile,
+			Token:   token.Token,
+			Scopes:  info.Scope,
+		}
+		if expiresAt, ok := info.ExpiresAt(); ok {
+			expiresAt = expiresAt.UTC().Truncate(time.Second)
+			out.ExpiresAt = &expiresAt
+		}
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			logger.Fatal("failed to encode token: %v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tokenCmd)
+	tokenCmd.Flags().BoolVar(&tokenJSON, "json", false, "Print the token, its expiry and scopes as JSON")
+}
@@ -0,0 +1,273 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/atnomoverflow/git-auth/pkg/audit"
+	"github.com/atnomoverflow/git-auth/pkg/config"
+	"github.com/atnomoverflow/git-auth/pkg/gitlab"
+	tokenstore "github.com/atnomoverflow/git-auth/pkg/token-store"
+	"github.com/spf13/cobra"
+)
+
+var assumeYesFlag bool
+
+// uninstallStep is one removal of the uninstall plan
+type uninstallStep struct {
+	profile     string
+	description string
+	run         func() error
+}
+
+// uninstallCmd represents the uninstall command
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove everything git-auth set up for a profile",
+	Long: `This command removes what git-auth created for the profile: the keys prefixed with ssh-prefix
+on GitLab, the stored token, the generated SSH config and git url rewrites, the known_hosts
+entries of the host and the local key files. The configuration file and the audit log are kept.
+
+The removals are listed first and only done after confirmation. Use --dry-run to only list
+them and --yes to skip the confirmation. Known_hosts entries still used by a profile that
+is not uninstalled are kept.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ts, err := initializeTokenStore()
+		if err != nil {
+			logger.Fatal("Token store setup failed: %v", err)
+		}
+		configs, err := uninstallConfigs()
+		if err != nil {
+			logger.Fatal("error loading config: %v", err)
+		}
+		shared, err := knownHostsInUse(configs)
+		if err != nil {
+			logger.Fatal("error loading config: %v", err)
+		}
+
+		var steps []uninstallStep
+		for _, cfg := range configs {
+			steps = append(steps, planUninstall(cfg, newGitlabClient(cfg), ts, shared)...)
+		}
+		if len(steps) == 0 {
+			logger.Info("Nothing to remove")
+			return
+		}
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PROFILE\tREMOVE")
+		for _, step := range steps {
+			fmt.Fprintf(w, "%s\t%s\n", step.profile, step.description)
+		}
+		w.Flush()
+		if dryRunFlag {
+			return
+		}
+		if !assumeYesFlag {
+			answer, err := prompt(bufio.NewReader(cmd.InOrStdin()), cmd.ErrOrStderr(), "Remove all of the above? (yes/no)", "no")
+			if err != nil {
+				logger.Fatal("failed to read the answer: %v", err)
+			}
+			if answer = strings.ToLower(answer); answer != "y" && answer != "yes" {
+				logger.Info("Nothing removed")
+				return
+			}
+		}
+
+		failed := 0
+		for _, step := range steps {
+			if err := step.run(); err != nil {
+				failed++
+				logger.Error("%s: failed to remove %s: %v", step.profile, step.description, err)
+			}
+		}
+		if failed > 0 {
+			logger.Fatal("%d of %d removals failed", failed, len(steps))
+		}
+		logger.Info("Removed %d items", len(steps))
+	},
+}
+
+// uninstallConfigs loads the selected profile, or the ones given by --all-profiles or --profiles
+func uninstallConfigs() ([]*config.Config, error) {
+	if !multipleProfiles() {
+		cfg, _, err := initializeConfigAndGitLabClient()
+		if err != nil {
+			return nil, err
+		}
+		return []*config.Config{cfg}, nil
+	}
+	loader := newConfigLoader()
+	profiles, err := selectedProfiles(loader)
+	if err != nil {
+		return nil, err
+	}
+	var configs []*config.Config
+	for _, profile := range profiles {
+		cfg, err := loader.LoadProfile(profile)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, cfg)
+	}
+	return configs, nil
+}
+
+// knownHostsInUse returns the known_hosts entries of the profiles that are not uninstalled
+func knownHostsInUse(uninstalled []*config.Config) (map[string]bool, error) {
+	skip := map[string]bool{}
+	for _, cfg := range uninstalled {
+		skip[cfg.Profile] = true
+	}
+	loader := newConfigLoader()
+	profiles, err := loader.Profiles()
+	if err != nil {
+		return nil, err
+	}
+	inUse := map[string]bool{}
+	for _, profile := range profiles {
+		if skip[profile] {
+			continue
+		}
+		cfg, err := loader.LoadProfile(profile)
+		if err != nil {
+			logger.Debug("skipping profile %s: %v", profile, err)
+			continue
+		}
+		inUse[knownHostsEntry(cfg)] = true
+	}
+	return inUse, nil
+}
+
+// knownHostsEntry identifies the known_hosts entries of a profile
+func knownHostsEntry(cfg *config.Config) string {
+	host := net.JoinHostPort(cfg.SSHHost, strconv.Itoa(cfg.SSHPort))
+	if cfg.HostKeyAlias != "" {
+		host = cfg.HostKeyAlias
+	}
+	return cfg.KnownHostsFile + " " + host
+}
+
+// planUninstall lists what git-auth created for the profile. Keys on GitLab are only
+// listed when the stored token still works.
+func planUninstall(cfg *config.Config, glc *gitlab.GitlabClient, ts *tokenstore.TokenStore, knownHostsInUse map[string]bool) []uninstallStep {
+	var steps []uninstallStep
+	add := func(description string, run func() error) {
+		steps = append(steps, uninstallStep{profile: cfg.Profile, description: description, run: run})
+	}
+	sshManager := newSSHManager(cfg)
+
+	token, _ := ts.GetToken(cfg.Profile)
+	if token != nil {
+		if _, err := requireLogin(cfg, glc, ts); err != nil {
+			logger.Warn("%s: the keys prefixed with %s are kept on GitLab: %v", cfg.Profile, cfg.SSHPrefix, err)
+		} else if keys, err := glc.ListSSHKeys(); err != nil {
+			logger.Warn("%s: the keys prefixed with %s are kept on GitLab: %v", cfg.Profile, cfg.SSHPrefix, err)
+		} else {
+			count := 0
+			for _, key := range keys {
+				if title, _ := key["title"].(string); strings.HasPrefix(title, cfg.SSHPrefix) {
+					count++
+				}
+			}
+			if count > 0 {
+				add(fmt.Sprintf("%d GitLab keys prefixed with %s", count, cfg.SSHPrefix), func() error {
+					return deleteSSHKeys(cfg, glc, cfg.SSHPrefix)
+				})
+			}
+		}
+		add("the stored token", func() error {
+			err := ts.RemoveToken(cfg.Profile)
+			recordAudit(cfg, glc, audit.Event{Action: audit.ActionTokenRemove, Detail: "uninstall"}, err)
+			return err
+		})
+	}
+
+	rewrites, err := countURLRewrites(cfg)
+	if err != nil {
+		logger.Warn("%s: %v", cfg.Profile, err)
+	}
+	if block, err := sshManager.CurrentConfigBlock(); err != nil {
+		logger.Warn("%s: %v", cfg.Profile, err)
+	} else if block != "" {
+		description := fmt.Sprintf("Host %s from the SSH config", cfg.SSHAlias)
+		if rewrites > 0 {
+			description += fmt.Sprintf(" and %d url rewrites to it from the git config", rewrites)
+		}
+		add(description, func() error {
+			_, err := removeSSHConfig(cfg, glc)
+			return err
+		})
+	} else if rewrites > 0 {
+		add(fmt.Sprintf("%d url rewrites to %s from the git config", rewrites, cfg.SSHAlias), func() error {
+			_, err := removeURLRewrites(cfg, glc)
+			return err
+		})
+	}
+
+	if knownHostsInUse[knownHostsEntry(cfg)] {
+		logger.Debug("%s: keeping the known_hosts entries used by other profiles", cfg.Profile)
+	} else if count, err := sshManager.KnownHostsEntries(); err != nil {
+		logger.Warn("%s: %v", cfg.Profile, err)
+	} else if count > 0 {
+		add(fmt.Sprintf("%d known_hosts entries of %s from %s", count, cfg.SSHHost, sshManager.KnownHostsFile()), func() error {
+			removed, err := sshManager.RemoveKnownHosts()
+			recordAudit(cfg, glc, audit.Event{
+				Action: audit.ActionKnownHostsEdit,
+				Path:   sshManager.KnownHostsFile(),
+				Detail: fmt.Sprintf("%d host keys of %s removed", removed, sshManager.Address()),
+			}, err)
+			return err
+		})
+	}
+
+	// the private key is removed even when its public key is missing or unreadable
+	if keyFiles := sshManager.KeyFiles(); len(keyFiles) > 0 {
+		var fingerprint string
+		if key, err := sshManager.LocalKey(); err == nil {
+			fingerprint = key.Fingerprint
+		}
+		add(fmt.Sprintf("the key files %s", strings.Join(keyFiles, " and ")), func() error {
+			_, err := sshManager.RemoveKeyPair()
+			recordAudit(cfg, glc, audit.Event{
+				Action:      audit.ActionKeyDelete,
+				Path:        keyFiles[0],
+				Fingerprint: fingerprint,
+				Detail:      "local key files",
+			}, err)
+			return err
+		})
+	}
+	return steps
+}
+
+func init() {
+	rootCmd.AddCommand(uninstallCmd)
+	addProfilesFlags(uninstallCmd)
+	uninstallCmd.Flags().BoolVarP(&assumeYesFlag, "yes", "y", false, "Remove without asking for confirmation")
+}
@@ -0,0 +1,176 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/atnomoverflow/git-auth/pkg/audit"
+	"github.com/atnomoverflow/git-auth/pkg/config"
+	"github.com/atnomoverflow/git-auth/pkg/gitconfig"
+	"github.com/spf13/cobra"
+)
+
+// useCmd represents the use command
+var useCmd = &cobra.Command{
+	Use:   "use <profile>",
+	Short: "Make the current repository use a profile's key and identity",
+	Long: `This command sets up the repository in the current directory for a profile:
+
+- core.sshCommand uses the profile key with IdentitiesOnly, so no other key is offered
+- user.name and user.email are the ones of the profile's GitLab user, as with git-identity --local
+- the origin remote points to the profile's ssh-alias over SSH, so later commands select
+  the profile from it
+
+Only the repository config is changed. Run generate-ssh-config for the profile first when
+its ssh-alias differs from its ssh-host.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := localGitConfig()
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+		loader := newConfigLoader()
+		cfg, err := loader.LoadProfile(args[0])
+		if err != nil {
+			logger.Fatal("error loading config: %v", err)
+		}
+		ts, err := initializeTokenStore()
+		if err != nil {
+			logger.Fatal("Token store setup failed: %v", err)
+		}
+		glc := newGitlabClient(cfg)
+
+		sshManager := newSSHManager(cfg)
+		key, err := sshManager.LocalKey()
+		if err != nil {
+			logger.Fatal("no key for profile %s (%v), run git-auth add-key --profile %s", cfg.Profile, err, cfg.Profile)
+		}
+		block, err := sshManager.CurrentConfigBlock()
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+		if block == "" && cfg.SSHAlias != cfg.SSHHost {
+			logger.Fatal("Host %s is not in the SSH config, run git-auth generate-ssh-config --profile %s", cfg.SSHAlias, cfg.Profile)
+		}
+		hosts, err := remoteHosts(loader, cfg)
+		if err != nil {
+			logger.Fatal("error loading config: %v", err)
+		}
+		// checked before anything is changed
+		current := gitConfig("--file", path, "--get", "remote.origin.url")
+		origin, ok := profileRemoteURL(cfg, current, hosts, block != "")
+		if current != "" && !ok {
+			logger.Fatal("origin %s is not on %s, the instance of profile %s", current, cfg.SSHHost, cfg.Profile)
+		}
+
+		id, err := fetchIdentity(cfg, glc, ts)
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+
+		sshCommand := fmt.Sprintf("ssh -i %s -o IdentitiesOnly=yes", shellQuote(key.Path))
+		// a single write, so the repository is never left half set up
+		err = editGitConfig(path, func(f *gitconfig.File) error {
+			if err := id.apply(f); err != nil {
+				return err
+			}
+			if err := f.Set("core.sshCommand", sshCommand); err != nil {
+				return err
+			}
+			if origin == "" {
+				logger.Warn("the repository has no origin remote to point to %s", cfg.SSHAlias)
+				return nil
+			}
+			return f.Set("remote.origin.url", origin)
+		})
+		recordAudit(cfg, glc, audit.Event{
+			Action: audit.ActionGitConfigEdit,
+			Path:   path,
+			Detail: fmt.Sprintf("user.name %s, user.email %s, core.sshCommand %s, remote.origin.url %s", id.user.Name, id.email, sshCommand, origin),
+		}, err)
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+		id.warnEffective()
+		logger.Info("%s <%s> set in %s", id.user.Name, id.email, path)
+		logger.Info("core.sshCommand set to %s", sshCommand)
+		if origin != "" {
+			logger.Info("origin set to %s", origin)
+		}
+	},
+}
+
+// remoteHosts returns the hosts a remote of the profile's instance can use: its url host,
+// its ssh-host and the aliases of every profile on that ssh-host
+func remoteHosts(loader *config.Loader, cfg *config.Config) (map[string]bool, error) {
+	hosts := map[string]bool{cfg.SSHHost: true, cfg.SSHAlias: true}
+	if host := config.RemoteHost(cfg.URL); host != "" {
+		hosts[host] = true
+	}
+	profiles, err := loader.Profiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, profile := range profiles {
+		other, err := loader.LoadProfile(profile)
+		if err != nil {
+			logger.Debug("skipping profile %s: %v", profile, err)
+			continue
+		}
+		if other.SSHHost == cfg.SSHHost {
+			hosts[other.SSHAlias] = true
+		}
+	}
+	return hosts, nil
+}
+
+// profileRemoteURL rewrites a remote url of the profile's instance to an SSH url through
+// its alias. It returns false for a remote on another host.
+func profileRemoteURL(cfg *config.Config, remote string, hosts map[string]bool, hasBlock bool) (string, bool) {
+	if !hosts[config.RemoteHost(remote)] {
+		return "", false
+	}
+	path := config.RemotePath(remote)
+	// an HTTPS url holds the relative url root of the instance, SSH urls do not
+	if strings.HasPrefix(remote, "http://") || strings.HasPrefix(remote, "https://") {
+		if u, err := url.Parse(cfg.URL); err == nil {
+			if root := strings.Trim(u.Path, "/"); root != "" {
+				path = strings.TrimPrefix(path, root+"/")
+			}
+		}
+	}
+	if strings.HasSuffix(strings.TrimSuffix(remote, "/"), ".git") {
+		path += ".git"
+	}
+	// without a Host block the port can only be given in the url
+	if !hasBlock && cfg.SSHPort != 22 {
+		return fmt.Sprintf("ssh://%s@%s:%d/%s", cfg.SSHUser, cfg.SSHAlias, cfg.SSHPort, path), true
+	}
+	return fmt.Sprintf("%s@%s:%s", cfg.SSHUser, cfg.SSHAlias, path), true
+}
+
+func init() {
+	rootCmd.AddCommand(useCmd)
+}
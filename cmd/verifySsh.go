@@ -0,0 +1,92 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/atnomoverflow/git-auth/pkg/config"
+	"github.com/atnomoverflow/git-auth/pkg/gitlab"
+	tokenstore "github.com/atnomoverflow/git-auth/pkg/token-store"
+	"github.com/spf13/cobra"
+)
+
+const (
+	verifyTimeout = 10 * time.Second
+	// a key that was just uploaded can take a moment to be accepted
+	verifyAttempts = 3
+	verifyDelay    = 2 * time.Second
+)
+
+var verifyFlag bool
+
+// verifySshCmd represents the verify-ssh command
+var verifySshCmd = &cobra.Command{
+	Use:   "verify-ssh",
+	Short: "Check the profile key authenticates over SSH as the logged-in user",
+	Long: `This command connects to the profile's ssh-host and ssh-port as git with the profile key and
+checks GitLab welcomes the same user the token belongs to, as in:
+
+  Welcome to GitLab, @user!
+
+It fails when the key is refused or belongs to another account, and when the host key is
+not in known_hosts, add it with git-auth known-hosts.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runForProfiles(cmd.OutOrStdout(), func(cfg *config.Config, glc *gitlab.GitlabClient, ts *tokenstore.TokenStore) (string, error) {
+			token, err := requireLogin(cfg, glc, ts)
+			if err != nil {
+				return "", err
+			}
+			return verifySSHKey(cfg, glc, token.Token, 1)
+		})
+	},
+}
+
+// verifySSHKey checks the profile key logs in over SSH as the owner of the token,
+// trying up to attempts times
+func verifySSHKey(cfg *config.Config, glc *gitlab.GitlabClient, token string, attempts int) (string, error) {
+	user, err := glc.GetUser(token)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+	sshManager := newSSHManager(cfg)
+
+	for attempt := 1; ; attempt++ {
+		_, err = sshManager.Verify(user.Username, verifyTimeout)
+		if err == nil {
+			return fmt.Sprintf("SSH to %s authenticates as @%s", sshManager.Address(), user.Username), nil
+		}
+		if attempt >= attempts || !strings.Contains(err.Error(), "unable to authenticate") {
+			return "", fmt.Errorf("SSH verification failed: %w", err)
+		}
+		logger.Debug("key not accepted yet, retrying: %v", err)
+		time.Sleep(verifyDelay)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(verifySshCmd)
+	addProfilesFlags(verifySshCmd)
+}
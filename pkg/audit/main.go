@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionLogin          = "login"
+	ActionTokenRefresh   = "token-refresh"
+	ActionTokenRemove    = "token-remove"
+	ActionTokenRevoke    = "token-revoke" // revoked or rejected by the server
+	ActionKeyAdd         = "key-add"
+	ActionKeyDelete      = "key-delete"
+	ActionSSHConfigEdit  = "ssh-config-edit"
+	ActionKnownHostsEdit = "known-hosts-edit"
+	ActionGitConfigEdit  = "git-config-edit"
+)
+
+// Outcomes of a recorded action.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Event is one line of the audit log.
+type Event struct {
+	Time        time.Time `json:"time"`
+	Action      string    `json:"action"`
+	Profile     string    `json:"profile,omitempty"`
+	Host        string    `json:"host,omitempty"`
+	User        string    `json:"user,omitempty"`
+	Outcome     string    `json:"outcome"`
+	Error       string    `json:"error,omitempty"`
+	KeyID       int       `json:"key_id,omitempty"`
+	KeyTitle    string    `json:"key_title,omitempty"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Path        string    `json:"path,omitempty"`
+	Detail      string    `json:"detail,omitempty"`
+}
+
+// Filter selects the events returned by Read. Zero values match everything.
+type Filter struct {
+	Since   time.Time
+	Profile string
+}
+
+func (f Filter) match(e Event) bool {
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	return f.Profile == "" || e.Profile == f.Profile
+}
+
+// Log is an append-only JSON lines file. Events are never rewritten or removed.
+type Log struct {
+	filePath string
+	mu       sync.Mutex
+}
+
+// New returns the audit log stored as audit.jsonl in dir.
+func New(dir string) *Log {
+	return &Log{filePath: filepath.Join(dir, "audit.jsonl")}
+}
+
+// Path returns the location of the audit file.
+func (l *Log) Path() string {
+	return l.filePath
+}
+
+// Record appends an event, stamping it with the current time when it has none.
+func (l *Log) Record(e Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC().Truncate(time.Second)
+	if e.Outcome == "" {
+		e.Outcome = OutcomeSuccess
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit event: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(l.filePath), 0700); err != nil {
+		return fmt.Errorf("failed to create audit directory: %w", err)
+	}
+	f, err := os.OpenFile(l.filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+	// a single write keeps concurrent processes from interleaving lines
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// Read returns the events matching the filter in the order they were recorded.
+// A missing file has no events.
+func (l *Log) Read(filter Filter) ([]Event, error) {
+	f, err := os.Open(l.filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid audit event: %w", l.filePath, n, err)
+		}
+		if filter.match(e) {
+			events = append(events, e)
+		}
+	}
+	return events, scanner.Err()
+}
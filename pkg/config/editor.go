@@ -0,0 +1,340 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/atnomoverflow/git-auth/pkg/files"
+)
+
+// Editor edits a TOML configuration file line by line so comments, ordering and
+// formatting the user wrote are kept. The empty section name is the top-level table.
+type Editor struct {
+	path  string
+	perm  os.FileMode
+	lines []string
+}
+
+var sectionHeaderPattern = regexp.MustCompile(`^(\s*\[\s*)("[^"]*"|[^\]\s]+)(\s*\].*)$`)
+
+// OpenEditor reads the configuration file at path; a missing file starts empty.
+func OpenEditor(path string) (*Editor, error) {
+	ed := &Editor{path: path, perm: 0600}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read configuration file: %w", err)
+	}
+	if err == nil {
+		if info, err := os.Stat(path); err == nil {
+			ed.perm = info.Mode().Perm()
+		}
+		text := strings.TrimSuffix(string(data), "\n")
+		if text != "" {
+			ed.lines = strings.Split(text, "\n")
+		}
+	}
+	return ed, nil
+}
+
+// Bytes returns the edited file content.
+func (ed *Editor) Bytes() []byte {
+	if len(ed.lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(ed.lines, "\n") + "\n")
+}
+
+// Save writes the file back, keeping its permissions.
+func (ed *Editor) Save() error {
+	return ed.SaveWith(files.New())
+}
+
+// SaveWith writes the file back with w, so the change can be backed up or only printed.
+func (ed *Editor) SaveWith(w *files.Writer) error {
+	return w.WriteFile(ed.path, ed.Bytes(), ed.perm)
+}
+
+// Sections returns the section names in file order, without subtables.
+func (ed *Editor) Sections() []string {
+	var sections []string
+	for _, line := range ed.lines {
+		if name, ok := parseHeader(line); ok && !strings.Contains(name, ".") {
+			sections = append(sections, name)
+		}
+	}
+	return sections
+}
+
+// HasSection reports whether the section is declared.
+func (ed *Editor) HasSection(section string) bool {
+	_, _, ok := ed.span(section)
+	return ok
+}
+
+// Get returns the raw TOML text of a key value, see DecodeValue.
+func (ed *Editor) Get(section, key string) (string, bool) {
+	start, end, ok := ed.body(section)
+	if !ok {
+		return "", false
+	}
+	first, last, ok := ed.find(start, end, key)
+	if !ok {
+		return "", false
+	}
+	_, value, _ := strings.Cut(strings.Join(ed.lines[first:last+1], "\n"), "=")
+	value, _ = splitComment(value)
+	return strings.TrimSpace(value), true
+}
+
+// Set sets a key in a section, creating the section when it does not exist.
+// An existing key is replaced in place, keeping its indentation and comment.
+func (ed *Editor) Set(section, key string, value interface{}) {
+	start, end, ok := ed.body(section)
+	if !ok {
+		ed.AddSection(section)
+		start, end, _ = ed.body(section)
+	}
+	if first, last, ok := ed.find(start, end, key); ok {
+		indent := ed.lines[first][:len(ed.lines[first])-len(strings.TrimLeft(ed.lines[first], " \t"))]
+		_, comment := splitComment(ed.lines[last])
+		line := fmt.Sprintf("%s%s = %s", indent, encodeKey(key), EncodeValue(value))
+		if comment != "" && first == last {
+			line += " " + comment
+		}
+		ed.replace(first, last+1, line)
+		return
+	}
+	// insert after the last non blank line of the section, leaving the
+	// comments describing the next section attached to it
+	at := end
+	for section == "" && at > start && strings.HasPrefix(strings.TrimSpace(ed.lines[at-1]), "#") {
+		at--
+	}
+	for at > start && strings.TrimSpace(ed.lines[at-1]) == "" {
+		at--
+	}
+	if section != "" && at == start {
+		at = start + 1
+	}
+	line := fmt.Sprintf("%s = %s", encodeKey(key), EncodeValue(value))
+	if section == "" && at < len(ed.lines) && strings.TrimSpace(ed.lines[at]) != "" {
+		// keep top-level keys apart from the first section
+		ed.replace(at, at, line, "")
+		return
+	}
+	ed.replace(at, at, line)
+}
+
+// Unset removes a key from a section and reports whether it was present.
+func (ed *Editor) Unset(section, key string) bool {
+	start, end, ok := ed.body(section)
+	if !ok {
+		return false
+	}
+	first, last, ok := ed.find(start, end, key)
+	if !ok {
+		return false
+	}
+	ed.replace(first, last+1)
+	return true
+}
+
+// AddSection appends an empty section at the end of the file.
+func (ed *Editor) AddSection(section string) error {
+	if ed.HasSection(section) {
+		return fmt.Errorf("section %s already exists", section)
+	}
+	if len(ed.lines) > 0 && strings.TrimSpace(ed.lines[len(ed.lines)-1]) != "" {
+		ed.lines = append(ed.lines, "")
+	}
+	ed.lines = append(ed.lines, fmt.Sprintf("[%s]", encodeKey(section)))
+	return nil
+}
+
+// RenameSection renames a section and its subtables.
+func (ed *Editor) RenameSection(from, to string) error {
+	if !ed.HasSection(from) {
+		return fmt.Errorf("section %s does not exist", from)
+	}
+	if ed.HasSection(to) {
+		return fmt.Errorf("section %s already exists", to)
+	}
+	for i, line := range ed.lines {
+		if name, ok := parseHeader(line); ok && (name == from || strings.HasPrefix(name, from+".")) {
+			m := sectionHeaderPattern.FindStringSubmatch(line)
+			ed.lines[i] = m[1] + encodeKey(to) + strings.TrimPrefix(name, from) + m[3]
+		}
+	}
+	return nil
+}
+
+// CopySection appends a copy of a section and its subtables under a new name.
+func (ed *Editor) CopySection(from, to string) error {
+	start, end, ok := ed.span(from)
+	if !ok {
+		return fmt.Errorf("section %s does not exist", from)
+	}
+	if ed.HasSection(to) {
+		return fmt.Errorf("section %s already exists", to)
+	}
+	for end > start && strings.TrimSpace(ed.lines[end-1]) == "" {
+		end--
+	}
+	copied := append([]string(nil), ed.lines[start:end]...)
+	for i, line := range copied {
+		if name, ok := parseHeader(line); ok && (name == from || strings.HasPrefix(name, from+".")) {
+			m := sectionHeaderPattern.FindStringSubmatch(line)
+			copied[i] = m[1] + encodeKey(to) + strings.TrimPrefix(name, from) + m[3]
+		}
+	}
+	if len(ed.lines) > 0 && strings.TrimSpace(ed.lines[len(ed.lines)-1]) != "" {
+		ed.lines = append(ed.lines, "")
+	}
+	ed.lines = append(ed.lines, copied...)
+	return nil
+}
+
+// DeleteSection removes a section, its subtables and the comments right above it.
+func (ed *Editor) DeleteSection(section string) error {
+	start, end, ok := ed.span(section)
+	if !ok || section == "" {
+		return fmt.Errorf("section %s does not exist", section)
+	}
+	for start > 0 && strings.HasPrefix(strings.TrimSpace(ed.lines[start-1]), "#") {
+		start--
+	}
+	// the blank lines before the next section are removed with the span,
+	// the last section takes the ones separating it from the previous instead
+	for end == len(ed.lines) && start > 0 && strings.TrimSpace(ed.lines[start-1]) == "" {
+		start--
+	}
+	ed.replace(start, end)
+	return nil
+}
+
+// span returns the lines [start, end) of a section including its subtables.
+// The top-level section starts at the first line and has no header.
+func (ed *Editor) span(section string) (int, int, bool) {
+	start := -1
+	if section == "" {
+		start = 0
+	}
+	for i, line := range ed.lines {
+		name, ok := parseHeader(line)
+		if !ok {
+			continue
+		}
+		if start < 0 {
+			if name == section {
+				start = i
+			}
+			continue
+		}
+		if section == "" || (name != section && !strings.HasPrefix(name, section+".")) {
+			return start, i, true
+		}
+	}
+	if start < 0 {
+		return 0, 0, false
+	}
+	return start, len(ed.lines), true
+}
+
+// body returns the lines [start, end) of a section without its subtables, where its
+// own keys are.
+func (ed *Editor) body(section string) (int, int, bool) {
+	start, end, ok := ed.span(section)
+	if !ok {
+		return 0, 0, false
+	}
+	for i := start + 1; i < end; i++ {
+		if _, ok := parseHeader(ed.lines[i]); ok {
+			return start, i, true
+		}
+	}
+	return start, end, true
+}
+
+// find returns the first and last line of a key between start and end, following
+// multi-line arrays. Keys of subtables are not considered.
+func (ed *Editor) find(start, end int, key string) (int, int, bool) {
+	for i := start; i < end; i++ {
+		line := ed.lines[i]
+		if i > start {
+			if _, ok := parseHeader(line); ok {
+				return 0, 0, false
+			}
+		}
+		m := keyPattern.FindStringSubmatch(line)
+		last := i
+		if m != nil {
+			_, value, _ := strings.Cut(line, "=")
+			for depth := bracketDepth(value); depth > 0 && last+1 < end; {
+				last++
+				depth += bracketDepth(ed.lines[last])
+			}
+		}
+		if m != nil && m[1] == key {
+			return i, last, true
+		}
+		i = last
+	}
+	return 0, 0, false
+}
+
+func (ed *Editor) replace(from, to int, lines ...string) {
+	updated := append([]string(nil), ed.lines[:from]...)
+	updated = append(updated, lines...)
+	ed.lines = append(updated, ed.lines[to:]...)
+}
+
+func parseHeader(line string) (string, bool) {
+	m := sectionHeaderPattern.FindStringSubmatch(line)
+	if m == nil || strings.HasPrefix(strings.TrimSpace(line), "[[") {
+		return "", false
+	}
+	return strings.Trim(m[2], `"`), true
+}
+
+// bracketDepth counts the unclosed brackets of a line outside of strings and comments.
+func bracketDepth(line string) int {
+	depth := 0
+	var quote rune
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return depth
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		}
+	}
+	return depth
+}
+
+// splitComment separates a trailing comment from a line.
+func splitComment(line string) (string, string) {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return line[:i], line[i:]
+		}
+	}
+	return line, ""
+}
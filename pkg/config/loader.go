@@ -0,0 +1,811 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	l "github.com/atnomoverflow/git-auth/pkg/logger"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Layers a configuration value can come from, from the lowest to the highest precedence.
+const (
+	LayerDefault = "default"
+	LayerSystem  = "system"
+	LayerUser    = "user"
+	LayerRepo    = "repo"
+	LayerEnv     = "env"
+	LayerFlag    = "flag"
+)
+
+const (
+	SystemConfigFile = "/etc/git-auth/config"
+	RepoConfigFile   = ".git-auth.toml"
+	DefaultProfile   = "default"
+	DefaultEnvPrefix = "GIT_AUTH"
+	// DefaultsSection is the table holding the values shared by every profile.
+	DefaultsSection = "defaults"
+)
+
+// Keys holds the settings every profile resolves.
+var Keys = []string{
+	"url", "client-id", "scope", "ssh-path", "ssh-prefix", "ssh-port", "ssh-host", "host-key-fingerprints", "known-hosts-file", "ssh-config-file",
+	"ssh-alias", "ssh-user", "identities-only", "identity-agent", "proxy-jump", "control-master", "control-persist",
+	"host-key-alias", "ssh-options", "ssh-config-template", "namespaces",
+}
+
+// built-in values used when no layer sets a key; ssh-host falls back to the host of url
+var defaults = map[string]interface{}{
+	"ssh-path":   "~/.ssh",
+	"ssh-prefix": "gl_auth",
+	"ssh-port":   int64(22),
+
+	"known-hosts-file": "~/.ssh/known_hosts",
+	"ssh-config-file":  "~/.ssh/config.d/git-auth",
+	"ssh-user":         "git",
+	"identities-only":  true,
+}
+
+// keys a repository file may set, in any profile, in [defaults] and at the top level.
+// Any other key could send a stored token to another server, write or delete keys in
+// another directory, route SSH elsewhere or select a profile, so a cloned repository
+// cannot change it.
+var repoKeys = map[string]bool{
+	"identities-only": true, "control-master": true, "control-persist": true,
+}
+
+// Source tells where a configuration value comes from.
+type Source struct {
+	Layer string
+	// Path is the file or the environment variable holding the value.
+	Path string
+	// Line is the line of the value in the file, 0 when unknown.
+	Line int
+}
+
+func (s Source) String() string {
+	switch {
+	case s.Path == "":
+		return s.Layer
+	case s.Line == 0:
+		return fmt.Sprintf("%s (%s)", s.Layer, s.Path)
+	default:
+		return fmt.Sprintf("%s (%s:%d)", s.Layer, s.Path, s.Line)
+	}
+}
+
+type entry struct {
+	value  interface{}
+	source Source
+}
+
+// document is the merge of every configuration file, keeping the source of each value.
+type document struct {
+	global   map[string]entry
+	sections map[string]map[string]entry
+	// headers locates the first declaration of each section
+	headers map[string]Source
+	// selected is the profile the unscoped environment variables and the overrides
+	// apply to, empty when resolving profiles one after the other
+	selected string
+}
+
+// Loader resolves profiles from layered configuration. Files are merged in the order
+// system, user, repository; environment variables and overrides then take precedence.
+// A profile key falls back to the profiles it extends, the [defaults] table, the same
+// top-level key and finally the built-in default.
+type Loader struct {
+	systemFile string
+	userFile   string
+	repoFile   string
+	workDir    string
+	envPrefix  string
+	profile    string
+	overrides  map[string]string
+	lookupEnv  func(string) (string, bool)
+	logger     l.Printer
+	doc        *document
+	// detectRemote selects the profile from the remotes of the repository in workDir
+	detectRemote bool
+}
+
+type LoaderOptions func(*Loader)
+
+// NewLoader creates a Loader reading the default locations, unless overridden by options.
+func NewLoader(ops ...LoaderOptions) *Loader {
+	ld := &Loader{
+		systemFile: SystemConfigFile,
+		envPrefix:  DefaultEnvPrefix,
+		overrides:  map[string]string{},
+		lookupEnv:  os.LookupEnv,
+		logger:     l.Discard,
+
+		detectRemote: true,
+	}
+	for _, op := range ops {
+		op(ld)
+	}
+	if ld.userFile == "" {
+		if path, ok := ld.env("CONFIG"); ok && path != "" {
+			ld.userFile = path
+		} else {
+			ld.userFile = defaultUserFile(ld.lookupEnv)
+		}
+	}
+	if ld.workDir == "" {
+		ld.workDir, _ = os.Getwd()
+	}
+	if ld.repoFile == "" && ld.workDir != "" {
+		ld.repoFile = findRepoFile(ld.workDir)
+	}
+	return ld
+}
+
+// WithSystemFile sets the system wide configuration file. An empty path disables it.
+func WithSystemFile(path string) LoaderOptions {
+	return func(ld *Loader) {
+		ld.systemFile = path
+	}
+}
+
+// WithConfigFile replaces the user configuration file.
+func WithConfigFile(path string) LoaderOptions {
+	return func(ld *Loader) {
+		ld.userFile = path
+	}
+}
+
+// WithRepoFile sets the repository configuration file instead of searching for it.
+func WithRepoFile(path string) LoaderOptions {
+	return func(ld *Loader) {
+		ld.repoFile = path
+	}
+}
+
+// WithWorkDir sets the directory the repository configuration file is searched from.
+func WithWorkDir(dir string) LoaderOptions {
+	return func(ld *Loader) {
+		ld.workDir = dir
+	}
+}
+
+// WithEnvPrefix sets the prefix of the environment variables, GIT_AUTH by default.
+// An empty prefix disables the environment layer.
+func WithEnvPrefix(prefix string) LoaderOptions {
+	return func(ld *Loader) {
+		ld.envPrefix = prefix
+	}
+}
+
+// WithLookupEnv replaces the function used to read environment variables.
+func WithLookupEnv(lookup func(string) (string, bool)) LoaderOptions {
+	return func(ld *Loader) {
+		ld.lookupEnv = lookup
+	}
+}
+
+// WithProfile selects the profile returned by Load.
+func WithProfile(profile string) LoaderOptions {
+	return func(ld *Loader) {
+		ld.profile = profile
+	}
+}
+
+// WithOverride sets a key of the selected profile with the highest precedence, from the
+// --set command line flag.
+func WithOverride(key, value string) LoaderOptions {
+	return func(ld *Loader) {
+		ld.overrides[key] = value
+	}
+}
+
+// WithRemoteDetection enables or disables the selection of the profile from the
+// remotes of the repository in the working directory. It is enabled by default.
+func WithRemoteDetection(enabled bool) LoaderOptions {
+	return func(ld *Loader) {
+		ld.detectRemote = enabled
+	}
+}
+
+// WithLogger sets where the loader logs, nothing is logged by default.
+func WithLogger(logger l.Printer) LoaderOptions {
+	return func(ld *Loader) {
+		if logger != nil {
+			ld.logger = logger
+		}
+	}
+}
+
+// UserFile returns the path of the user configuration file.
+func (ld *Loader) UserFile() string {
+	return ld.userFile
+}
+
+// Files returns the configuration files by layer, from the lowest precedence.
+func (ld *Loader) Files() []Source {
+	var files []Source
+	for _, file := range []Source{
+		{Layer: LayerSystem, Path: ld.systemFile},
+		{Layer: LayerUser, Path: ld.userFile},
+		{Layer: LayerRepo, Path: ld.repoFile},
+	} {
+		if file.Path != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// SelectedProfile returns the name of the profile Load resolves.
+func (ld *Loader) SelectedProfile() (string, error) {
+	doc, err := ld.read()
+	if err != nil {
+		return "", err
+	}
+	return ld.selectProfile(doc)
+}
+
+// Load resolves the selected profile. The selection order is the WithProfile option,
+// the PROFILE environment variable, the profile matching the remotes of the current
+// repository, the top-level default-profile key and finally "default".
+func (ld *Loader) Load() (*Config, error) {
+	doc, err := ld.read()
+	if err != nil {
+		return nil, err
+	}
+	profile, err := ld.selectProfile(doc)
+	if err != nil {
+		return nil, err
+	}
+	// the document is shared by the calls of the loader, the selection is not
+	selected := *doc
+	selected.selected = profile
+	return ld.resolveProfile(&selected, profile)
+}
+
+// LoadProfile resolves the given profile. Only the environment variables scoped to
+// the profile apply, as in GIT_AUTH_WORK_URL for the profile work.
+func (ld *Loader) LoadProfile(profile string) (*Config, error) {
+	doc, err := ld.read()
+	if err != nil {
+		return nil, err
+	}
+	return ld.resolveProfile(doc, profile)
+}
+
+// Profiles returns the names of every profile with a url, own or inherited, in
+// alphabetical order. Bases without a url are only used through extends, and profiles
+// only a repository file defines are only used when named.
+func (ld *Loader) Profiles() ([]string, error) {
+	doc, err := ld.read()
+	if err != nil {
+		return nil, err
+	}
+	var profiles []string
+	for name := range doc.sections {
+		if name == DefaultsSection || repoOnly(doc, name) {
+			continue
+		}
+		if e, ok := ld.lookup(doc, name, "url"); ok && e.value != "" {
+			profiles = append(profiles, name)
+		}
+	}
+	sort.Strings(profiles)
+	return profiles, nil
+}
+
+func (ld *Loader) selectProfile(doc *document) (string, error) {
+	if ld.profile != "" {
+		return ld.profile, nil
+	}
+	if profile, ok := ld.env("PROFILE"); ok && profile != "" {
+		return profile, nil
+	}
+	if ld.detectRemote && ld.workDir != "" {
+		profile, err := ld.profileForRepo(doc, ld.workDir)
+		if err != nil {
+			return "", err
+		}
+		if profile != "" {
+			return profile, nil
+		}
+	}
+	// profile is the historical name of default-profile
+	for _, key := range []string{"default-profile", "profile"} {
+		if e, ok := doc.global[key]; ok {
+			if profile, ok := e.value.(string); ok && profile != "" {
+				return profile, nil
+			}
+		}
+	}
+	return DefaultProfile, nil
+}
+
+func (ld *Loader) resolveProfile(doc *document, profile string) (*Config, error) {
+	if _, ok := doc.sections[profile]; !ok || profile == DefaultsSection {
+		return nil, fmt.Errorf("No profile named %s", profile)
+	}
+	if _, err := ld.chain(doc, profile); err != nil {
+		return nil, err
+	}
+	cfg := &Config{Profile: profile, Sources: map[string]Source{}}
+
+	var err error
+	get := func(key string) interface{} {
+		e, ok := ld.lookup(doc, profile, key)
+		if ok {
+			cfg.Sources[key] = e.source
+		}
+		return e.value
+	}
+	if cfg.URL, err = asString(get("url")); err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("profile %s has no url", profile)
+	}
+	if cfg.ClientID, err = asString(get("client-id")); err != nil {
+		return nil, fmt.Errorf("invalid client-id: %w", err)
+	}
+	if cfg.Scope, err = asStrings(get("scope")); err != nil {
+		return nil, fmt.Errorf("invalid scope: %w", err)
+	}
+	if cfg.SSHPath, err = asString(get("ssh-path")); err != nil {
+		return nil, fmt.Errorf("invalid ssh-path: %w", err)
+	}
+	if cfg.SSHPath, err = expandHome(cfg.SSHPath); err != nil {
+		return nil, err
+	}
+	if cfg.SSHPrefix, err = asString(get("ssh-prefix")); err != nil {
+		return nil, fmt.Errorf("invalid ssh-prefix: %w", err)
+	}
+	if cfg.SSHPort, err = asInt(get("ssh-port")); err != nil {
+		return nil, fmt.Errorf("invalid ssh-port: %w", err)
+	}
+	if cfg.SSHHost, err = asString(get("ssh-host")); err != nil {
+		return nil, fmt.Errorf("invalid ssh-host: %w", err)
+	}
+	if cfg.SSHHost == "" {
+		if u, err := url.Parse(cfg.URL); err == nil {
+			cfg.SSHHost = u.Hostname()
+			cfg.Sources["ssh-host"] = Source{Layer: LayerDefault, Path: "url"}
+		}
+	}
+	if cfg.HostKeyFingerprints, err = asStrings(get("host-key-fingerprints")); err != nil {
+		return nil, fmt.Errorf("invalid host-key-fingerprints: %w", err)
+	}
+	if cfg.KnownHostsFile, err = asString(get("known-hosts-file")); err != nil {
+		return nil, fmt.Errorf("invalid known-hosts-file: %w", err)
+	}
+	if cfg.KnownHostsFile, err = expandHome(cfg.KnownHostsFile); err != nil {
+		return nil, err
+	}
+	if cfg.SSHConfigFile, err = asString(get("ssh-config-file")); err != nil {
+		return nil, fmt.Errorf("invalid ssh-config-file: %w", err)
+	}
+	if cfg.SSHConfigFile, err = expandHome(cfg.SSHConfigFile); err != nil {
+		return nil, err
+	}
+	if cfg.SSHAlias, err = asString(get("ssh-alias")); err != nil {
+		return nil, fmt.Errorf("invalid ssh-alias: %w", err)
+	}
+	if cfg.SSHAlias == "" {
+		cfg.SSHAlias = ld.defaultAlias(doc, profile, cfg.SSHHost)
+		cfg.Sources["ssh-alias"] = Source{Layer: LayerDefault, Path: "ssh-host"}
+	}
+	if cfg.SSHUser, err = asString(get("ssh-user")); err != nil {
+		return nil, fmt.Errorf("invalid ssh-user: %w", err)
+	}
+	if cfg.IdentitiesOnly, err = asBool(get("identities-only")); err != nil {
+		return nil, fmt.Errorf("invalid identities-only: %w", err)
+	}
+	for key, field := range map[string]*string{
+		"identity-agent":  &cfg.IdentityAgent,
+		"proxy-jump":      &cfg.ProxyJump,
+		"control-master":  &cfg.ControlMaster,
+		"control-persist": &cfg.ControlPersist,
+		"host-key-alias":  &cfg.HostKeyAlias,
+	} {
+		if *field, err = asString(get(key)); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	if cfg.SSHOptions, err = asOptions(get("ssh-options")); err != nil {
+		return nil, fmt.Errorf("invalid ssh-options: %w", err)
+	}
+	if cfg.SSHConfigTemplate, err = asString(get("ssh-config-template")); err != nil {
+		return nil, fmt.Errorf("invalid ssh-config-template: %w", err)
+	}
+	if cfg.SSHConfigTemplate, err = expandHome(cfg.SSHConfigTemplate); err != nil {
+		return nil, err
+	}
+	if cfg.Namespaces, err = asStrings(get("namespaces")); err != nil {
+		return nil, fmt.Errorf("invalid namespaces: %w", err)
+	}
+	for i, namespace := range cfg.Namespaces {
+		cfg.Namespaces[i] = strings.Trim(namespace, "/")
+	}
+	return cfg, nil
+}
+
+// defaultAlias returns the ssh-host of a profile, or ssh-host followed by the profile
+// name when another profile uses the same ssh-host, so each gets its own Host block.
+// Only the system and user files are looked at, so the alias does not change with the
+// repository the command runs in or the environment.
+func (ld *Loader) defaultAlias(doc *document, profile, host string) string {
+	if fileHost := ld.sshHost(doc, profile); fileHost != "" {
+		host = fileHost
+	}
+	for name := range doc.sections {
+		if name == profile || name == DefaultsSection || repoOnly(doc, name) {
+			continue
+		}
+		if e, ok := ld.fileLookup(doc, name, "url"); !ok || e.value == "" {
+			continue
+		}
+		if ld.sshHost(doc, name) == host {
+			return host + "-" + aliasUnsafe.ReplaceAllString(profile, "-")
+		}
+	}
+	return host
+}
+
+// aliasUnsafe matches the characters of a profile name left out of a Host alias
+var aliasUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// envUnsafe matches the characters of a profile name replaced in its environment variables
+var envUnsafe = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// sshHost resolves only the ssh-host of a profile from the system and user files,
+// falling back to the host of its url
+func (ld *Loader) sshHost(doc *document, profile string) string {
+	if e, ok := ld.fileLookup(doc, profile, "ssh-host"); ok {
+		if host, err := asString(e.value); err == nil && host != "" {
+			return host
+		}
+	}
+	e, _ := ld.fileLookup(doc, profile, "url")
+	rawURL, _ := asString(e.value)
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Hostname()
+	}
+	return ""
+}
+
+// lookup returns the value of a profile key from the layer with the highest precedence.
+// The overrides and the environment variables named after the key only apply to the
+// selected profile, so commands going through every profile do not send all of them to
+// the same server; variables scoped to a profile apply to it alone.
+func (ld *Loader) lookup(doc *document, profile, key string) (entry, bool) {
+	selected := profile != "" && profile == doc.selected
+	if value, ok := ld.overrides[key]; ok && selected {
+		return entry{value: value, source: Source{Layer: LayerFlag, Path: "--set " + key}}, true
+	}
+	name := envKey(key)
+	if value, ok := ld.env(envKey(profile) + "_" + name); ok {
+		return entry{value: value, source: Source{Layer: LayerEnv, Path: ld.envName(envKey(profile) + "_" + name)}}, true
+	}
+	if value, ok := ld.env(name); ok && selected {
+		return entry{value: value, source: Source{Layer: LayerEnv, Path: ld.envName(name)}}, true
+	}
+	chain, _ := ld.chain(doc, profile)
+	for _, section := range append(chain, DefaultsSection) {
+		if e, ok := doc.sections[section][key]; ok {
+			return e, true
+		}
+	}
+	if e, ok := doc.global[key]; ok {
+		return e, true
+	}
+	if value, ok := defaults[key]; ok {
+		return entry{value: value, source: Source{Layer: LayerDefault}}, true
+	}
+	return entry{}, false
+}
+
+// fileLookup is lookup without the environment, the overrides and the repository file.
+func (ld *Loader) fileLookup(doc *document, profile, key string) (entry, bool) {
+	chain, _ := ld.chain(doc, profile)
+	for _, section := range append(chain, DefaultsSection) {
+		if e, ok := doc.sections[section][key]; ok && e.source.Layer != LayerRepo {
+			return e, true
+		}
+	}
+	if e, ok := doc.global[key]; ok && e.source.Layer != LayerRepo {
+		return e, true
+	}
+	if value, ok := defaults[key]; ok {
+		return entry{value: value, source: Source{Layer: LayerDefault}}, true
+	}
+	return entry{}, false
+}
+
+// chain returns the profile followed by the profiles it extends, nearest first.
+// On error the chain is cut before the faulty link.
+func (ld *Loader) chain(doc *document, profile string) ([]string, error) {
+	chain := []string{profile}
+	for {
+		e, ok := doc.sections[profile]["extends"]
+		if !ok {
+			return chain, nil
+		}
+		base, ok := e.value.(string)
+		if !ok {
+			return chain, fmt.Errorf("extends of profile %s must be a profile name", profile)
+		}
+		if _, ok := doc.sections[base]; !ok || base == DefaultsSection {
+			return chain, fmt.Errorf("profile %s extends unknown profile %s", profile, base)
+		}
+		for _, seen := range chain {
+			if seen == base {
+				return chain, fmt.Errorf("profile %s extends itself through %s", chain[0], strings.Join(append(chain, base), " -> "))
+			}
+		}
+		chain = append(chain, base)
+		profile = base
+	}
+}
+
+// read merges the configuration files, later layers overriding earlier ones key by key.
+// The files are read once per Loader.
+func (ld *Loader) read() (*document, error) {
+	if ld.doc != nil {
+		return ld.doc, nil
+	}
+	doc := &document{
+		global:   map[string]entry{},
+		sections: map[string]map[string]entry{},
+		headers:  map[string]Source{},
+	}
+	for _, file := range ld.Files() {
+		data, err := os.ReadFile(file.Path)
+		if os.IsNotExist(err) {
+			ld.debug("configuration file %s not found, skipping", file.Path)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read configuration file: %w", err)
+		}
+		values := map[string]interface{}{}
+		if err := toml.Unmarshal(data, &values); err != nil {
+			var decodeErr *toml.DecodeError
+			if errors.As(err, &decodeErr) {
+				row, col := decodeErr.Position()
+				return nil, fmt.Errorf("failed to parse configuration file %s:%d:%d: %w", file.Path, row, col, err)
+			}
+			return nil, fmt.Errorf("failed to parse configuration file %s: %w", file.Path, err)
+		}
+		ld.debug("loaded configuration file %s", file.Path)
+		lines := indexLines(data)
+		at := func(section, key string) Source {
+			src := file
+			src.Line = lines[section+"."+key]
+			return src
+		}
+		for key, value := range values {
+			table, ok := value.(map[string]interface{})
+			if !ok {
+				if file.Layer == LayerRepo && !repoKeys[key] {
+					ld.warn("ignoring top-level %s in %s: repository files cannot change it", key, file.Path)
+					continue
+				}
+				doc.global[key] = entry{value: value, source: at("", key)}
+				continue
+			}
+			section, exists := doc.sections[key]
+			if !exists {
+				section = map[string]entry{}
+				doc.sections[key] = section
+				doc.headers[key] = at(key, "")
+			}
+			for k, v := range table {
+				if file.Layer == LayerRepo && !repoKeys[k] {
+					ld.warn("ignoring %s of profile %s in %s: repository files cannot change it", k, key, file.Path)
+					continue
+				}
+				section[k] = entry{value: v, source: at(key, k)}
+			}
+		}
+	}
+	ld.doc = doc
+	return doc, nil
+}
+
+var (
+	headerPattern = regexp.MustCompile(`^\s*\[\s*"?([^"\[\]]+?)"?\s*\]`)
+	keyPattern    = regexp.MustCompile(`^\s*"?([A-Za-z0-9_-]+)"?\s*=`)
+)
+
+// repoOnly tells whether a profile is only defined by the repository file
+func repoOnly(doc *document, name string) bool {
+	return doc.headers[name].Layer == LayerRepo
+}
+
+// indexLines maps "section.key" to its line in a TOML file; headers are stored
+// as "section." and top-level keys as ".key".
+func indexLines(data []byte) map[string]int {
+	lines := map[string]int{}
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if m := headerPattern.FindStringSubmatch(line); m != nil {
+			section = m[1]
+			if _, ok := lines[section+"."]; !ok {
+				lines[section+"."] = n
+			}
+		} else if m := keyPattern.FindStringSubmatch(line); m != nil {
+			lines[section+"."+m[1]] = n
+		}
+	}
+	return lines
+}
+
+func (ld *Loader) env(name string) (string, bool) {
+	if ld.envPrefix == "" {
+		return "", false
+	}
+	return ld.lookupEnv(ld.envName(name))
+}
+
+func (ld *Loader) envName(name string) string {
+	return ld.envPrefix + "_" + name
+}
+
+// envKey returns a key or a profile name as it appears in environment variables,
+// upper case with underscores
+func envKey(name string) string {
+	return strings.ToUpper(envUnsafe.ReplaceAllString(name, "_"))
+}
+
+func (ld *Loader) debug(message string, args ...interface{}) {
+	ld.logger.Debug(message, args...)
+}
+
+func (ld *Loader) warn(message string, args ...interface{}) {
+	ld.logger.Warn(message, args...)
+}
+
+// defaultUserFile prefers $XDG_CONFIG_HOME/git-auth/config when it exists and
+// falls back to ~/.git-auth/config.
+func defaultUserFile(lookupEnv func(string) (string, bool)) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	xdg, ok := lookupEnv("XDG_CONFIG_HOME")
+	if !ok || xdg == "" {
+		xdg = filepath.Join(home, ".config")
+	}
+	if path := filepath.Join(xdg, "git-auth", "config"); fileExists(path) {
+		return path
+	}
+	return filepath.Join(home, ".git-auth", "config")
+}
+
+// findRepoFile returns the nearest repository configuration file between dir and
+// the root of its git repository. Outside of a repository no file is used.
+func findRepoFile(dir string) string {
+	candidate := ""
+	for {
+		if candidate == "" && fileExists(filepath.Join(dir, RepoConfigFile)) {
+			candidate = filepath.Join(dir, RepoConfigFile)
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return candidate
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
+
+func asString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case int64, float64, bool:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("expected a string, got %T", value)
+	}
+}
+
+// asStrings accepts an array or a string separated by spaces or commas.
+func asStrings(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return strings.FieldsFunc(v, func(r rune) bool { return r == ' ' || r == ',' }), nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := asString(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("expected a list of strings, got %T", value)
+	}
+}
+
+// asOptions accepts an array of options or a single option, as an option such as
+// "ServerAliveInterval 60" contains a space.
+func asOptions(value interface{}) ([]string, error) {
+	if s, ok := value.(string); ok {
+		if strings.TrimSpace(s) == "" {
+			return nil, nil
+		}
+		return []string{s}, nil
+	}
+	return asStrings(value)
+}
+
+// asBool accepts booleans and the yes/no strings of ssh_config.
+func asBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "true", "yes":
+			return true, nil
+		case "false", "no":
+			return false, nil
+		}
+		return false, fmt.Errorf("expected true or false, got %q", v)
+	default:
+		return false, fmt.Errorf("expected a boolean, got %T", value)
+	}
+}
+
+// asInt accepts integers and numeric strings, as the port is often quoted.
+func asInt(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		return int(v), nil
+	case string:
+		return strconv.Atoi(strings.TrimSpace(v))
+	default:
+		return 0, fmt.Errorf("expected a number, got %T", value)
+	}
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newTestLoader writes the user and repository files to a temporary directory and
+// returns a Loader reading only them
+func newTestLoader(t *testing.T, user, repo string, ops ...LoaderOptions) *Loader {
+	t.Helper()
+	dir := t.TempDir()
+	userFile := filepath.Join(dir, "config")
+	repoFile := filepath.Join(dir, RepoConfigFile)
+	if err := os.WriteFile(userFile, []byte(user), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(repoFile, []byte(repo), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return NewLoader(append([]LoaderOptions{
+		WithSystemFile(""),
+		WithConfigFile(userFile),
+		WithRepoFile(repoFile),
+		WithWorkDir(dir),
+		WithEnvPrefix(""),
+		WithRemoteDetection(false),
+	}, ops...)...)
+}
+
+func TestRepoFileKeys(t *testing.T) {
+	user := `
+[work]
+url = "https://gitlab.example.com"
+client-id = "user-client"
+ssh-path = "/home/user/.ssh"
+ssh-host = "ssh.example.com"
+`
+	repo := `
+ssh-user = "top-level"
+default-profile = "repo"
+
+[defaults]
+ssh-port = 2222
+
+[work]
+url = "https://evil.example.com"
+client-id = "evil-client"
+ssh-path = "/tmp/evil"
+ssh-host = "evil.example.com"
+ssh-port = 2200
+ssh-alias = "gitlab.example.com"
+ssh-user = "evil"
+ssh-prefix = ""
+host-key-alias = "evil"
+namespaces = ["acme"]
+identities-only = false
+control-persist = "10m"
+
+[repo]
+url = "https://repo.example.com"
+client-id = "repo-client"
+ssh-path = "/srv/repo/.ssh"
+ssh-port = 2022
+control-master = "no"
+`
+	ld := newTestLoader(t, user, repo)
+
+	work, err := ld.LoadProfile("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		key, want string
+	}{
+		{"url", "https://gitlab.example.com"},
+		{"client-id", "user-client"},
+		{"ssh-path", "/home/user/.ssh"},
+		{"ssh-host", "ssh.example.com"},
+		{"ssh-port", "22"},
+		{"ssh-alias", "ssh.example.com"},
+		{"ssh-user", "git"},
+		{"ssh-prefix", "gl_auth"},
+		{"host-key-alias", ""},
+		{"namespaces", ""},
+		// the harmless keys a repository may set
+		{"identities-only", "false"},
+		{"control-persist", "10m"},
+	} {
+		if got := work.Value(tc.key); got != tc.want {
+			t.Errorf("work %s = %q, want %q", tc.key, got, tc.want)
+		}
+	}
+
+	// a profile the repository defines itself is held to the same keys, so it has no url
+	if _, err := ld.LoadProfile("repo"); err == nil {
+		t.Error("repo profile loaded with the url of the repository file")
+	}
+
+	// and neither selects it nor takes part in matching
+	if profile, err := ld.SelectedProfile(); err != nil || profile != DefaultProfile {
+		t.Errorf("selected profile = %q, %v, want %s", profile, err, DefaultProfile)
+	}
+	if profiles, err := ld.Profiles(); err != nil || !reflect.DeepEqual(profiles, []string{"work"}) {
+		t.Errorf("profiles = %v, %v, want [work]", profiles, err)
+	}
+}
+
+func TestEnvScope(t *testing.T) {
+	user := `
+default-profile = "work"
+
+[work]
+url = "https://gitlab.example.com"
+
+[home]
+url = "https://gitlab.com"
+`
+	env := map[string]string{
+		"GIT_AUTH_URL":           "https://env.example.com",
+		"GIT_AUTH_HOME_SSH_PORT": "2222",
+	}
+	ld := newTestLoader(t, user, "", WithEnvPrefix(DefaultEnvPrefix), WithLookupEnv(func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}))
+
+	selected, err := ld.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selected.URL != "https://env.example.com" || selected.Sources["url"].Layer != LayerEnv {
+		t.Errorf("selected url = %q from %v, want it from GIT_AUTH_URL", selected.URL, selected.Sources["url"])
+	}
+	for _, tc := range []struct {
+		profile, url string
+		port         int
+	}{
+		{"work", "https://gitlab.example.com", 22},
+		{"home", "https://gitlab.com", 2222},
+	} {
+		cfg, err := ld.LoadProfile(tc.profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.URL != tc.url || cfg.SSHPort != tc.port {
+			t.Errorf("%s = %s port %d, want %s port %d", tc.profile, cfg.URL, cfg.SSHPort, tc.url, tc.port)
+		}
+	}
+}
+
+func TestDefaultAlias(t *testing.T) {
+	user := `
+[work]
+url = "https://gitlab.com"
+
+[home]
+url = "https://gitlab.com"
+
+["my client"]
+url = "https://gitlab.example.com"
+ssh-host = "gitlab.com"
+
+[solo]
+url = "https://git.acme.com"
+
+[pinned]
+url = "https://git.acme.com"
+ssh-host = "ssh.acme.com"
+ssh-alias = "acme"
+
+[base]
+ssh-host = "git.acme.com"
+`
+	env := map[string]string{"GIT_AUTH_URL": "https://gitlab.com"}
+	ld := newTestLoader(t, user, "", WithEnvPrefix(DefaultEnvPrefix), WithProfile("solo"), WithLookupEnv(func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}))
+
+	for _, tc := range []struct {
+		profile, want string
+	}{
+		// profiles sharing an ssh-host, given or taken from their url
+		{"work", "gitlab.com-work"},
+		{"home", "gitlab.com-home"},
+		{"my client", "gitlab.com-my-client"},
+		// a base without url is not a profile of its own
+		{"solo", "git.acme.com"},
+		{"pinned", "acme"},
+	} {
+		cfg, err := ld.LoadProfile(tc.profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.SSHAlias != tc.want {
+			t.Errorf("%s ssh-alias = %q, want %q", tc.profile, cfg.SSHAlias, tc.want)
+		}
+	}
+
+	// GIT_AUTH_URL moves the selected profile to gitlab.com, not its alias
+	selected, err := ld.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selected.SSHHost != "gitlab.com" || selected.SSHAlias != "git.acme.com" {
+		t.Errorf("solo = host %s alias %s, want host gitlab.com alias git.acme.com", selected.SSHHost, selected.SSHAlias)
+	}
+}
+
+func TestDefaultAliasIgnoresRepoProfiles(t *testing.T) {
+	user := `
+[work]
+url = "https://gitlab.com"
+`
+	repo := `
+[other]
+url = "https://gitlab.com"
+`
+	cfg, err := newTestLoader(t, user, repo).LoadProfile("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SSHAlias != "gitlab.com" {
+		t.Errorf("ssh-alias = %q, want gitlab.com whatever the repository defines", cfg.SSHAlias)
+	}
+}
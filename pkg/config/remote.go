@@ -0,0 +1,245 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Remote is a git remote of the repository the command runs in.
+type Remote struct {
+	Name string
+	URL  string
+}
+
+var remoteSectionPattern = regexp.MustCompile(`^\s*\[\s*remote\s+"([^"]+)"\s*\]`)
+
+// FindGitDir returns the git directory of the repository containing dir, following
+// the .git file of worktrees and submodules. It returns an empty path outside of a repository.
+func FindGitDir(dir string) (string, error) {
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		info, err := os.Stat(dotGit)
+		if err == nil {
+			if info.IsDir() {
+				return dotGit, nil
+			}
+			data, err := os.ReadFile(dotGit)
+			if err != nil {
+				return "", fmt.Errorf("failed to read %s: %w", dotGit, err)
+			}
+			gitDir := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(data)), "gitdir:"))
+			if !filepath.IsAbs(gitDir) {
+				gitDir = filepath.Join(dir, gitDir)
+			}
+			return gitDir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// ReadRemotes returns the remotes declared in the config of a git directory,
+// reading the common directory of worktrees.
+func ReadRemotes(gitDir string) ([]Remote, error) {
+	if data, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		common := strings.TrimSpace(string(data))
+		if !filepath.IsAbs(common) {
+			common = filepath.Join(gitDir, common)
+		}
+		gitDir = common
+	}
+	f, err := os.Open(filepath.Join(gitDir, "config"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git config: %w", err)
+	}
+	defer f.Close()
+
+	var remotes []Remote
+	current := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			current = ""
+			if m := remoteSectionPattern.FindStringSubmatch(line); m != nil {
+				current = m[1]
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if current == "" || !ok || !strings.EqualFold(strings.TrimSpace(key), "url") {
+			continue
+		}
+		remotes = append(remotes, Remote{Name: current, URL: strings.Trim(strings.TrimSpace(value), `"`)})
+	}
+	return remotes, scanner.Err()
+}
+
+// RemoteHost returns the host of a git remote url, either a url with a scheme
+// (https, ssh, git) or the scp-like user@host:path form.
+func RemoteHost(remote string) string {
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+		if err != nil {
+			return ""
+		}
+		return u.Hostname()
+	}
+	host, _, ok := strings.Cut(remote, ":")
+	if !ok || strings.Contains(host, "/") {
+		// a local path
+		return ""
+	}
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		host = host[i+1:]
+	}
+	return host
+}
+
+// RemotePath returns the project path of a git remote url, without the .git suffix.
+func RemotePath(remote string) string {
+	path := ""
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+		if err != nil {
+			return ""
+		}
+		path = u.Path
+	} else if _, rest, ok := strings.Cut(remote, ":"); ok {
+		path = rest
+	}
+	return strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+}
+
+// InNamespace reports whether the project path belongs to the group or user namespace.
+func InNamespace(path, namespace string) bool {
+	return namespace != "" && strings.HasPrefix(strings.ToLower(path)+"/", strings.ToLower(namespace)+"/")
+}
+
+// profileHosts returns every host name a remote of the profile can use.
+func profileHosts(cfg *Config) []string {
+	hosts := []string{cfg.SSHHost}
+	if cfg.SSHAlias != cfg.SSHHost {
+		hosts = append(hosts, cfg.SSHAlias)
+	}
+	if u, err := url.Parse(cfg.URL); err == nil {
+		hosts = append(hosts, u.Hostname())
+	}
+	return hosts
+}
+
+// ProfileForRepo returns the profile matching the remotes of the repository containing
+// dir. The origin remote is looked at first, then all the others together. It returns
+// an empty name when nothing matches and an error when several profiles do.
+func (ld *Loader) ProfileForRepo(dir string) (string, error) {
+	doc, err := ld.read()
+	if err != nil {
+		return "", err
+	}
+	return ld.profileForRepo(doc, dir)
+}
+
+func (ld *Loader) profileForRepo(doc *document, dir string) (string, error) {
+	gitDir, err := FindGitDir(dir)
+	if err != nil || gitDir == "" {
+		return "", err
+	}
+	remotes, err := ReadRemotes(gitDir)
+	if err != nil {
+		return "", err
+	}
+
+	byHost := map[string][]string{}
+	namespaces := map[string][]string{}
+	for name := range doc.sections {
+		if name == DefaultsSection || repoOnly(doc, name) {
+			continue
+		}
+		cfg, err := ld.resolveProfile(doc, name)
+		if err != nil {
+			continue
+		}
+		namespaces[name] = cfg.Namespaces
+		seen := map[string]bool{}
+		for _, host := range profileHosts(cfg) {
+			if host != "" && !seen[host] {
+				seen[host] = true
+				byHost[host] = append(byHost[host], name)
+			}
+		}
+	}
+
+	var origin, others []Remote
+	for _, remote := range remotes {
+		if remote.Name == "origin" {
+			origin = append(origin, remote)
+		} else {
+			others = append(others, remote)
+		}
+	}
+	for _, group := range [][]Remote{origin, others} {
+		matches := map[string][]string{}
+		for _, remote := range group {
+			host := RemoteHost(remote.URL)
+			for _, profile := range namespaceProfiles(byHost[host], namespaces, RemotePath(remote.URL)) {
+				matches[profile] = append(matches[profile], fmt.Sprintf("%s (%s)", remote.Name, host))
+			}
+		}
+		switch len(matches) {
+		case 0:
+			continue
+		case 1:
+			for profile, via := range matches {
+				ld.debug("selected profile %s from remote %s", profile, strings.Join(via, ", "))
+				return profile, nil
+			}
+		default:
+			var candidates []string
+			for profile, via := range matches {
+				candidates = append(candidates, fmt.Sprintf("%s via %s", profile, strings.Join(via, ", ")))
+			}
+			sort.Strings(candidates)
+			return "", fmt.Errorf("the remotes of this repository match several profiles (%s), choose one with --profile", strings.Join(candidates, "; "))
+		}
+	}
+	ld.debug("no profile matches the remotes of this repository")
+	return "", nil
+}
+
+// namespaceProfiles narrows the profiles sharing a host to the ones whose namespaces
+// hold the project path, keeping the longest match. They are all kept when none does.
+func namespaceProfiles(profiles []string, namespaces map[string][]string, path string) []string {
+	if len(profiles) < 2 {
+		return profiles
+	}
+	var matched []string
+	longest := 0
+	for _, profile := range profiles {
+		best := 0
+		for _, namespace := range namespaces[profile] {
+			if InNamespace(path, namespace) {
+				best = max(best, len(namespace))
+			}
+		}
+		switch {
+		case best == 0 || best < longest:
+		case best > longest:
+			matched, longest = []string{profile}, best
+		default:
+			matched = append(matched, profile)
+		}
+	}
+	if matched == nil {
+		return profiles
+	}
+	return matched
+}
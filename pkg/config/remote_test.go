@@ -0,0 +1,37 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNamespaceProfiles(t *testing.T) {
+	namespaces := map[string][]string{
+		"work":  {"acme", "acme-labs/tools"},
+		"tools": {"acme-labs/tools/cli"},
+		"home":  nil,
+		"twin":  {"acme"},
+	}
+	for _, tc := range []struct {
+		name     string
+		profiles []string
+		path     string
+		want     []string
+	}{
+		{"single profile is kept", []string{"home"}, "someone/app", []string{"home"}},
+		{"no profile", nil, "acme/app", nil},
+		{"namespace match", []string{"home", "work"}, "acme/app", []string{"work"}},
+		{"case is ignored", []string{"home", "work"}, "ACME/App", []string{"work"}},
+		{"prefix of a segment is not a match", []string{"home", "work"}, "acme-corp/app", []string{"home", "work"}},
+		{"longest namespace wins", []string{"work", "tools"}, "acme-labs/tools/cli/main", []string{"tools"}},
+		{"shorter namespace when the longer does not hold it", []string{"work", "tools"}, "acme-labs/tools/api", []string{"work"}},
+		{"ties are all kept", []string{"work", "twin", "home"}, "acme/app", []string{"work", "twin"}},
+		{"all kept without match", []string{"work", "home"}, "other/app", []string{"work", "home"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := namespaceProfiles(tc.profiles, namespaces, tc.path); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("namespaceProfiles(%v, %q) = %v, want %v", tc.profiles, tc.path, got, tc.want)
+			}
+		})
+	}
+}
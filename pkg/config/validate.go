@@ -0,0 +1,255 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// KnownScopes lists the OAuth scopes accepted by GitLab applications.
+var KnownScopes = []string{
+	"api", "read_api", "read_user", "create_runner", "manage_runner", "k8s_proxy", "self_rotate",
+	"read_repository", "write_repository", "read_registry", "write_registry",
+	"read_virtual_registry", "write_virtual_registry", "read_observability", "write_observability",
+	"ai_features", "sudo", "admin_mode", "read_service_ping", "openid", "profile", "email",
+}
+
+var fingerprintPattern = regexp.MustCompile(`^SHA256:[A-Za-z0-9+/]{43}$`)
+
+// sshOptionPattern matches a single "Keyword value" line of ssh_config
+var sshOptionPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*([ \t]+|[ \t]*=[ \t]*)[^ \t\r\n][^\r\n]*$`)
+
+// namespacePattern matches a GitLab group, subgroup or user path
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9_.][A-Za-z0-9_.-]*(/[A-Za-z0-9_.][A-Za-z0-9_.-]*)*$`)
+
+// keys written as is to the generated SSH config
+var sshValueKeys = []string{"ssh-alias", "ssh-user", "identity-agent", "proxy-jump", "control-master", "control-persist", "host-key-alias"}
+
+// Problem is a configuration error reported by Validate.
+type Problem struct {
+	Profile string
+	Key     string
+	Source  Source
+	Message string
+}
+
+func (p Problem) String() string {
+	location := p.Source.Layer
+	if p.Source.Path != "" {
+		location = p.Source.Path
+		if p.Source.Line > 0 {
+			location = fmt.Sprintf("%s:%d", p.Source.Path, p.Source.Line)
+		}
+	}
+	return fmt.Sprintf("%s: [%s] %s: %s", location, p.Profile, p.Key, p.Message)
+}
+
+// Validate checks every profile and returns all the problems found, sorted by profile.
+// The error is only set when the configuration files cannot be read or parsed.
+func (ld *Loader) Validate() ([]Problem, error) {
+	shared, err := ld.read()
+	if err != nil {
+		return nil, err
+	}
+	// the unscoped environment variables are checked on the profile they apply to
+	selected := *shared
+	selected.selected, _ = ld.selectProfile(shared)
+	doc := &selected
+	names := make([]string, 0, len(doc.sections))
+	for name := range doc.sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	extended := map[string]bool{}
+	for _, name := range names {
+		if chain, _ := ld.chain(doc, name); len(chain) > 1 {
+			extended[chain[1]] = true
+		}
+	}
+
+	var problems []Problem
+	for _, name := range names {
+		if name == DefaultsSection {
+			continue
+		}
+		// a base without url only exists to be extended
+		if _, hasURL := ld.lookup(doc, name, "url"); extended[name] && !hasURL {
+			continue
+		}
+		if _, err := ld.chain(doc, name); err != nil {
+			e := doc.sections[name]["extends"]
+			problems = append(problems, Problem{Profile: name, Key: "extends", Source: e.source, Message: err.Error()})
+			continue
+		}
+		problems = append(problems, ld.validateProfile(doc, name)...)
+	}
+	return problems, nil
+}
+
+func (ld *Loader) validateProfile(doc *document, profile string) []Problem {
+	var problems []Problem
+	report := func(key string, e entry, found bool, format string, args ...interface{}) {
+		src := e.source
+		if !found {
+			src = doc.headers[profile]
+		}
+		problems = append(problems, Problem{
+			Profile: profile,
+			Key:     key,
+			Source:  src,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	e, found := ld.lookup(doc, profile, "url")
+	if rawURL, err := asString(e.value); err != nil {
+		report("url", e, found, "%v", err)
+	} else if rawURL == "" {
+		report("url", e, found, "missing url")
+	} else if u, err := url.Parse(rawURL); err != nil {
+		report("url", e, found, "invalid url: %v", err)
+	} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		report("url", e, found, "url %q must be an absolute http or https url", rawURL)
+	}
+
+	e, found = ld.lookup(doc, profile, "client-id")
+	if clientID, err := asString(e.value); err != nil {
+		report("client-id", e, found, "%v", err)
+	} else if clientID == "" {
+		report("client-id", e, found, "missing client-id")
+	}
+
+	e, found = ld.lookup(doc, profile, "scope")
+	if scopes, err := asStrings(e.value); err != nil {
+		report("scope", e, found, "%v", err)
+	} else if len(scopes) == 0 {
+		report("scope", e, found, "no scope requested")
+	} else {
+		for _, scope := range scopes {
+			if !isKnownScope(scope) {
+				report("scope", e, found, "unknown GitLab scope %q", scope)
+			}
+		}
+	}
+
+	e, found = ld.lookup(doc, profile, "ssh-port")
+	if port, err := asInt(e.value); err != nil {
+		report("ssh-port", e, found, "invalid port: %v", err)
+	} else if port < 1 || port > 65535 {
+		report("ssh-port", e, found, "port %d is out of range", port)
+	}
+
+	e, found = ld.lookup(doc, profile, "host-key-fingerprints")
+	if fingerprints, err := asStrings(e.value); err != nil {
+		report("host-key-fingerprints", e, found, "%v", err)
+	} else {
+		for _, fingerprint := range fingerprints {
+			if !fingerprintPattern.MatchString(fingerprint) {
+				report("host-key-fingerprints", e, found, "%q is not a SHA256 fingerprint such as SHA256:%s", fingerprint, strings.Repeat("x", 43))
+			}
+		}
+	}
+
+	for _, key := range sshValueKeys {
+		e, found = ld.lookup(doc, profile, key)
+		if value, err := asString(e.value); err != nil {
+			report(key, e, found, "%v", err)
+		} else if strings.ContainsAny(value, "\r\n") {
+			report(key, e, found, "%s must fit on one line", key)
+		} else if key == "ssh-alias" && strings.ContainsAny(value, " \t*?!,") {
+			report(key, e, found, "ssh-alias %q must be a single host name without patterns", value)
+		}
+	}
+
+	e, found = ld.lookup(doc, profile, "identities-only")
+	if _, err := asBool(e.value); err != nil {
+		report("identities-only", e, found, "%v", err)
+	}
+
+	e, found = ld.lookup(doc, profile, "ssh-options")
+	if options, err := asOptions(e.value); err != nil {
+		report("ssh-options", e, found, "%v", err)
+	} else {
+		for _, option := range options {
+			if !sshOptionPattern.MatchString(strings.TrimSpace(option)) {
+				report("ssh-options", e, found, "%q is not an SSH option such as \"ServerAliveInterval 60\"", option)
+			}
+		}
+	}
+
+	e, found = ld.lookup(doc, profile, "ssh-config-template")
+	if path, err := asString(e.value); err != nil {
+		report("ssh-config-template", e, found, "%v", err)
+	} else if path != "" {
+		if path, err = expandHome(path); err != nil {
+			report("ssh-config-template", e, found, "%v", err)
+		} else if _, err := os.Stat(path); err != nil {
+			report("ssh-config-template", e, found, "%v", err)
+		}
+	}
+
+	e, found = ld.lookup(doc, profile, "namespaces")
+	if namespaces, err := asStrings(e.value); err != nil {
+		report("namespaces", e, found, "%v", err)
+	} else {
+		for _, namespace := range namespaces {
+			if !namespacePattern.MatchString(strings.Trim(namespace, "/")) {
+				report("namespaces", e, found, "%q is not a group or user path such as acme/platform", namespace)
+			}
+		}
+	}
+
+	e, found = ld.lookup(doc, profile, "ssh-path")
+	if sshPath, err := asString(e.value); err != nil {
+		report("ssh-path", e, found, "%v", err)
+	} else if sshPath, err = expandHome(sshPath); err != nil {
+		report("ssh-path", e, found, "%v", err)
+	} else if err := checkWritableDir(sshPath); err != nil {
+		report("ssh-path", e, found, "%v", err)
+	}
+
+	return problems
+}
+
+func isKnownScope(scope string) bool {
+	for _, known := range KnownScopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
+
+// checkWritableDir makes sure keys can be written to dir, or to its nearest
+// existing parent when it has not been created yet.
+func checkWritableDir(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return fmt.Errorf("no existing parent for %s", dir)
+		}
+		dir = parent
+	}
+
+	f, err := os.CreateTemp(dir, ".git-auth-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable", dir)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/atnomoverflow/git-auth/pkg/files"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Setting is a key and value to write into a configuration file.
+type Setting struct {
+	Key   string
+	Value interface{}
+}
+
+// AppendProfile appends a new profile section to the configuration file at path,
+// creating it with w when needed. It fails if the file already defines the profile.
+func AppendProfile(path, profile string, settings []Setting, w *files.Writer) error {
+	ed, err := OpenEditor(path)
+	if err != nil {
+		return err
+	}
+	if err := ed.AddSection(profile); err != nil {
+		return fmt.Errorf("profile %s already exists in %s", profile, path)
+	}
+	for _, setting := range settings {
+		ed.Set(profile, setting.Key, setting.Value)
+	}
+	return ed.SaveWith(w)
+}
+
+// ParseValue converts the text given for a key on the command line to its TOML type.
+func ParseValue(key, text string) (interface{}, error) {
+	switch key {
+	case "ssh-port":
+		port, err := strconv.Atoi(text)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("%q is not a valid port", text)
+		}
+		return port, nil
+	case "scope", "host-key-fingerprints", "namespaces":
+		return asStrings(text)
+	case "identities-only":
+		return asBool(text)
+	case "ssh-options":
+		return asOptions(text)
+	}
+	return text, nil
+}
+
+// DecodeValue parses the raw TOML text of a value returned by Editor.Get.
+func DecodeValue(raw string) (interface{}, error) {
+	var doc struct {
+		Value interface{} `toml:"value"`
+	}
+	if err := toml.Unmarshal([]byte("value = "+raw), &doc); err != nil {
+		return nil, fmt.Errorf("invalid value %s: %w", raw, err)
+	}
+	return doc.Value, nil
+}
+
+// FormatValue returns a decoded value as text, the items of a list separated by spaces
+// as in Config.Value.
+func FormatValue(value interface{}) string {
+	if items, ok := value.([]interface{}); ok {
+		texts := make([]string, len(items))
+		for i, item := range items {
+			texts[i] = FormatValue(item)
+		}
+		return strings.Join(texts, " ")
+	}
+	return fmt.Sprint(value)
+}
+
+// EncodeValue formats a string, number, boolean or list of strings as a TOML value.
+func EncodeValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return encodeString(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case []string:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = encodeString(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	default:
+		return encodeString(fmt.Sprint(v))
+	}
+}
+
+func encodeString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&sb, `\u%04X`, r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// encodeKey quotes keys that are not bare TOML keys.
+func encodeKey(key string) string {
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return encodeString(key)
+		}
+	}
+	return key
+}
@@ -0,0 +1,202 @@
+package files
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// backupTimeFormat names the backup directories, sorting them by time
+const backupTimeFormat = "20060102-150405"
+
+// MaxBackups is the number of backups kept, older ones are removed when a new one is made.
+const MaxBackups = 20
+
+// ErrBackupNotFound is returned by OpenBackup for an unknown backup.
+var ErrBackupNotFound = errors.New("backup not found")
+
+// Backup is a directory holding the originals of the files changed by one command.
+type Backup struct {
+	ID      string       `json:"id"`
+	Time    time.Time    `json:"time"`
+	Command string       `json:"command,omitempty"`
+	Files   []BackupFile `json:"files"`
+
+	dir string
+}
+
+// BackupFile is the original state of one file of a backup.
+type BackupFile struct {
+	Path string `json:"path"`
+	// Existed is false for a file that was created, restoring it removes the file
+	Existed bool        `json:"existed"`
+	Mode    os.FileMode `json:"mode,omitempty"`
+	// Secret files, keys and tokens, are not copied so no credential outlives its removal.
+	// Restoring puts back only the absence of a secret that was created.
+	Secret bool `json:"secret,omitempty"`
+	// Copy is the name of the copy in the backup directory, empty for secrets
+	Copy string `json:"copy,omitempty"`
+}
+
+func newBackup(root, command string) (*Backup, error) {
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, err
+	}
+	if err := pruneBackups(root, MaxBackups-1); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	id := now.Format(backupTimeFormat)
+	// several commands may run within the same second
+	for n := 2; ; n++ {
+		err := os.Mkdir(filepath.Join(root, id), 0700)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		id = now.Format(backupTimeFormat) + "-" + strconv.Itoa(n)
+	}
+	return &Backup{
+		ID:      id,
+		Time:    now.UTC().Truncate(time.Second),
+		Command: command,
+		dir:     filepath.Join(root, id),
+	}, nil
+}
+
+func (b *Backup) has(path string) bool {
+	for _, file := range b.Files {
+		if file.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// add copies the original content of path and records it in the manifest
+func (b *Backup) add(path string, data []byte, existed bool, mode os.FileMode, secret bool) error {
+	file := BackupFile{Path: path, Existed: existed, Mode: mode, Secret: secret}
+	if existed && !secret {
+		file.Copy = strconv.Itoa(len(b.Files)+1) + "-" + filepath.Base(path)
+		if err := writeFile(filepath.Join(b.dir, file.Copy), data, 0600); err != nil {
+			return err
+		}
+	}
+	b.Files = append(b.Files, file)
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(b.dir, "manifest.json"), data, 0600)
+}
+
+// Restorable returns the number of files restoring the backup puts back, leaving out the
+// secrets that existed, which are not copied.
+func (b *Backup) Restorable() int {
+	n := 0
+	for _, file := range b.Files {
+		if !file.Existed || file.Copy != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// Dir returns the directory of the backup.
+func (b *Backup) Dir() string {
+	return b.dir
+}
+
+// ListBackups returns the backups kept under root, oldest first.
+func ListBackups(root string) ([]*Backup, error) {
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", root, err)
+	}
+	var backups []*Backup
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		backup, err := OpenBackup(root, entry.Name())
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].ID < backups[j].ID })
+	return backups, nil
+}
+
+// pruneBackups removes the oldest backups under root until keep are left
+func pruneBackups(root string, keep int) error {
+	backups, err := ListBackups(root)
+	if err != nil {
+		return err
+	}
+	for len(backups) > keep {
+		if err := os.RemoveAll(backups[0].dir); err != nil {
+			return fmt.Errorf("failed to remove backup %s: %w", backups[0].ID, err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// OpenBackup reads the manifest of the backup id kept under root.
+func OpenBackup(root, id string) (*Backup, error) {
+	if id == "" || id != filepath.Base(id) || id == "." || id == ".." {
+		return nil, fmt.Errorf("%w: %q", ErrBackupNotFound, id)
+	}
+	dir := filepath.Join(root, id)
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrBackupNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup %s: %w", id, err)
+	}
+	backup := &Backup{dir: dir}
+	if err := json.Unmarshal(data, backup); err != nil {
+		return nil, fmt.Errorf("invalid backup %s: %w", id, err)
+	}
+	backup.ID = id
+	return backup, nil
+}
+
+// Restore puts back the files of a backup as they were before the command that made it,
+// removing the files it created. Secrets that existed are left as they are since they
+// were not copied. The changes go through the writer, so they are backed up in turn or
+// only printed in dry-run mode.
+func (w *Writer) Restore(b *Backup) error {
+	for _, file := range b.Files {
+		if file.Existed && file.Copy == "" {
+			w.logger.Warn("%s is not restored, keys and tokens are not backed up", file.Path)
+			continue
+		}
+		if !file.Existed {
+			if err := w.change(file.Path, nil, 0, file.Secret, true); err != nil {
+				return err
+			}
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(b.dir, file.Copy))
+		if err != nil {
+			return fmt.Errorf("failed to read the backup of %s: %w", file.Path, err)
+		}
+		if err := w.change(file.Path, data, file.Mode, file.Secret, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupKeepsNoSecrets(t *testing.T) {
+	dir := t.TempDir()
+	backups := filepath.Join(dir, "backups")
+	config, key := filepath.Join(dir, "config"), filepath.Join(dir, "id")
+	if err := os.WriteFile(config, []byte("old config\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(key, []byte("old key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	w := New(WithBackupDir(backups, "test"))
+	if err := w.WriteFile(config, []byte("new config\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteSecret(key, []byte("new key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	backup := w.Backup()
+	if backup == nil || len(backup.Files) != 2 {
+		t.Fatalf("backup = %+v, want 2 files", backup)
+	}
+	if backup.Files[1].Copy != "" {
+		t.Errorf("the secret was copied to %s", backup.Files[1].Copy)
+	}
+	entries, err := os.ReadDir(backup.Dir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		data, _ := os.ReadFile(filepath.Join(backup.Dir(), entry.Name()))
+		if string(data) == "old key\n" {
+			t.Errorf("%s holds the secret", entry.Name())
+		}
+	}
+
+	opened, err := OpenBackup(backups, backup.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := New().Restore(opened); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(config); string(data) != "old config\n" {
+		t.Errorf("config = %q after restore", data)
+	}
+	if data, _ := os.ReadFile(key); string(data) != "new key\n" {
+		t.Errorf("key = %q after restore, want it left as is", data)
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < MaxBackups+3; i++ {
+		path := filepath.Join(root, "file")
+		w := New(WithBackupDir(root, "test"))
+		if err := w.WriteFile(path, []byte{byte(i)}, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups, err := ListBackups(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != MaxBackups {
+		t.Errorf("%d backups kept, want %d", len(backups), MaxBackups)
+	}
+}
+
+func TestBackupNotMadeForSecretsAlone(t *testing.T) {
+	dir := t.TempDir()
+	backups := filepath.Join(dir, "backups")
+	token, config := filepath.Join(dir, "token"), filepath.Join(dir, "config")
+
+	w := New(WithBackupDir(backups, "test"))
+	if err := w.WriteSecret(token, []byte("old token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteSecret(token, []byte("new token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if backup := w.Backup(); backup != nil {
+		t.Fatalf("backup %s made for secrets alone", backup.ID)
+	}
+	if _, err := os.Stat(backups); !os.IsNotExist(err) {
+		t.Errorf("backup directory created: %v", err)
+	}
+
+	if err := w.WriteFile(config, []byte("config\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	backup := w.Backup()
+	if backup == nil || len(backup.Files) != 2 {
+		t.Fatalf("backup = %+v, want the token and the config", backup)
+	}
+	if backup.Files[0].Path != token || backup.Files[0].Existed {
+		t.Errorf("first file = %+v, want the token as created", backup.Files[0])
+	}
+	if n := backup.Restorable(); n != 2 {
+		t.Errorf("Restorable() = %d, want 2", n)
+	}
+}
@@ -0,0 +1,65 @@
+package files
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// numbers returns the lines 1 to n, with the replacements given by line number
+func numbers(n int, replaced map[int]string) []byte {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		if line, ok := replaced[i]; ok {
+			sb.WriteString(line + "\n")
+			continue
+		}
+		fmt.Fprintf(&sb, "%d\n", i)
+	}
+	return []byte(sb.String())
+}
+
+func TestDiff(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		old, new []byte
+		want     string
+	}{
+		{"equal", numbers(5, nil), numbers(5, nil), ""},
+		{"both empty", nil, nil, ""},
+		{"new file", nil, []byte("a\nb\n"), "@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"removed file", []byte("a\nb\n"), nil, "@@ -1,2 +0,0 @@\n-a\n-b\n"},
+		{"missing final newline is not a change", []byte("a\nb"), []byte("a\nb\n"), ""},
+		{
+			"one line with three lines of context",
+			numbers(10, nil), numbers(10, map[int]string{5: "five"}),
+			"@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			"close changes share a hunk",
+			numbers(10, nil), numbers(10, map[int]string{2: "two", 8: "eight"}),
+			"@@ -1,10 +1,10 @@\n 1\n-2\n+two\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n 9\n 10\n",
+		},
+		{
+			"distant changes get their own hunks",
+			numbers(20, nil), numbers(20, map[int]string{2: "two", 18: "eighteen"}),
+			"@@ -1,5 +1,5 @@\n 1\n-2\n+two\n 3\n 4\n 5\n" +
+				"@@ -15,6 +15,6 @@\n 15\n 16\n 17\n-18\n+eighteen\n 19\n 20\n",
+		},
+		{
+			"insertion",
+			[]byte("a\nc\n"), []byte("a\nb\nc\n"),
+			"@@ -1,2 +1,3 @@\n a\n+b\n c\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			want := tc.want
+			if want != "" {
+				want = "--- old\n+++ new\n" + want
+			}
+			if got := Diff("old", "new", tc.old, tc.new); got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package files
+
+import (
+	"io"
+
+	l "github.com/atnomoverflow/git-auth/pkg/logger"
+)
+
+type Options func(*Writer)
+
+// WithDryRun makes the writer print a diff of each change instead of writing it.
+func WithDryRun(dryRun bool) Options {
+	return func(w *Writer) {
+		w.dryRun = dryRun
+	}
+}
+
+// WithBackupDir keeps the original of the changed files in a timestamped directory
+// under dir, described by command.
+func WithBackupDir(dir, command string) Options {
+	return func(w *Writer) {
+		w.backupDir = dir
+		w.command = command
+	}
+}
+
+// WithOutput sets where dry-run changes are printed, stdout by default.
+func WithOutput(out io.Writer) Options {
+	return func(w *Writer) {
+		w.out = out
+	}
+}
+
+// WithLogger sets where the writer logs, nothing is logged by default.
+func WithLogger(logger l.Printer) Options {
+	return func(w *Writer) {
+		if logger != nil {
+			w.logger = logger
+		}
+	}
+}
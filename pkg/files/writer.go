@@ -0,0 +1,202 @@
+package files
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	l "github.com/atnomoverflow/git-auth/pkg/logger"
+)
+
+// Writer writes the files git-auth manages. Before changing a file it keeps a copy of it
+// in a timestamped backup, and in dry-run mode it prints what would change instead.
+type Writer struct {
+	dryRun    bool
+	backupDir string
+	command   string
+	out       io.Writer
+	logger    l.Printer
+
+	mu sync.Mutex
+	// backup holds the original of each file changed by this writer, created on the first
+	// change of a file that is not a secret
+	backup *Backup
+	// secrets are the secrets changed before the backup was created
+	secrets []BackupFile
+}
+
+// New creates a Writer changing files in place. Backups are only kept with WithBackupDir.
+func New(ops ...Options) *Writer {
+	w := &Writer{
+		out:    os.Stdout,
+		logger: l.Discard,
+	}
+	for _, op := range ops {
+		op(w)
+	}
+	return w
+}
+
+// DryRun reports whether the writer only prints the changes.
+func (w *Writer) DryRun() bool {
+	return w.dryRun
+}
+
+// WriteFile replaces the content of path, creating its directory when needed.
+func (w *Writer) WriteFile(path string, data []byte, perm os.FileMode) error {
+	return w.change(path, data, perm, false, false)
+}
+
+// WriteSecret is WriteFile for files holding keys or tokens, whose content is never
+// printed in a diff.
+func (w *Writer) WriteSecret(path string, data []byte, perm os.FileMode) error {
+	return w.change(path, data, perm, true, false)
+}
+
+// Remove deletes path. A missing file is not an error.
+func (w *Writer) Remove(path string) error {
+	return w.change(path, nil, 0, false, true)
+}
+
+// RemoveSecret is Remove for files holding keys or tokens.
+func (w *Writer) RemoveSecret(path string) error {
+	return w.change(path, nil, 0, true, true)
+}
+
+// change writes data to path, or removes it
+func (w *Writer) change(path string, data []byte, perm os.FileMode, secret, remove bool) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	old, err := os.ReadFile(path)
+	existed := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if (remove && !existed) || (!remove && existed && bytes.Equal(old, data)) {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.dryRun {
+		w.printChange(path, old, data, existed, remove, secret)
+		return nil
+	}
+	if w.backupDir != "" {
+		if err := w.keep(path, old, existed, secret); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+	}
+	if remove {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		w.logger.Debug("removed %s", path)
+		return nil
+	}
+	if err := writeFile(path, data, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	w.logger.Debug("wrote %s", path)
+	return nil
+}
+
+// keep copies the original of path to the backup of this writer, once per file. Secrets
+// are not copied, so a backup is only created for a file that is not one: a token
+// refresh alone would otherwise make a backup with nothing to restore, pruning the
+// useful ones.
+func (w *Writer) keep(path string, data []byte, existed, secret bool) error {
+	if w.backup != nil && w.backup.has(path) {
+		return nil
+	}
+	var mode os.FileMode
+	if existed {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		mode = info.Mode().Perm()
+	}
+	if w.backup == nil {
+		if secret {
+			for _, file := range w.secrets {
+				if file.Path == path {
+					return nil
+				}
+			}
+			w.secrets = append(w.secrets, BackupFile{Path: path, Existed: existed, Mode: mode, Secret: true})
+			return nil
+		}
+		backup, err := newBackup(w.backupDir, w.command)
+		if err != nil {
+			return err
+		}
+		w.backup = backup
+		for _, file := range w.secrets {
+			if err := w.backup.add(file.Path, nil, file.Existed, file.Mode, true); err != nil {
+				return err
+			}
+		}
+		w.secrets = nil
+	}
+	if err := w.backup.add(path, data, existed, mode, secret); err != nil {
+		return err
+	}
+	w.logger.Debug("backed up %s to %s", path, w.backup.dir)
+	return nil
+}
+
+// Backup returns the backup of the files changed so far, nil when nothing was backed up.
+func (w *Writer) Backup() *Backup {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.backup
+}
+
+func (w *Writer) printChange(path string, old, data []byte, existed, remove, secret bool) {
+	switch {
+	case secret && remove:
+		fmt.Fprintf(w.out, "would remove %s (content not shown)\n", path)
+	case secret && existed:
+		fmt.Fprintf(w.out, "would change %s (content not shown)\n", path)
+	case secret:
+		fmt.Fprintf(w.out, "would create %s (content not shown)\n", path)
+	default:
+		oldName, newName := path, path
+		if !existed {
+			oldName = "/dev/null"
+		}
+		if remove {
+			newName = "/dev/null"
+		}
+		fmt.Fprint(w.out, Diff(oldName, newName, old, data))
+	}
+}
+
+// writeFile writes data to a temporary file renamed over path, so a failed write never
+// leaves a truncated file behind.
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
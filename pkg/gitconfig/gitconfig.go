@@ -0,0 +1,175 @@
+package gitconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/atnomoverflow/git-auth/pkg/files"
+)
+
+// Entry is a key and one of its values.
+type Entry struct {
+	Key   string
+	Value string
+}
+
+// File is a git configuration file edited through a temporary copy with git config, so
+// the result can be written back with a files.Writer, backed up or shown as a diff.
+type File struct {
+	path string
+	mode os.FileMode
+	tmp  string
+}
+
+// GlobalPath returns the file git config --global writes to: $GIT_CONFIG_GLOBAL, or
+// ~/.gitconfig unless only $XDG_CONFIG_HOME/git/config exists.
+func GlobalPath() (string, error) {
+	if path := os.Getenv("GIT_CONFIG_GLOBAL"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	path := filepath.Join(home, ".gitconfig")
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" {
+		xdg = filepath.Join(home, ".config")
+	}
+	if _, err := os.Stat(filepath.Join(xdg, "git", "config")); err == nil {
+		return filepath.Join(xdg, "git", "config"), nil
+	}
+	return path, nil
+}
+
+// LocalPath returns the config file of a git directory, the one of the main repository
+// for worktrees.
+func LocalPath(gitDir string) string {
+	if data, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		common := strings.TrimSpace(string(data))
+		if !filepath.IsAbs(common) {
+			common = filepath.Join(gitDir, common)
+		}
+		gitDir = common
+	}
+	return filepath.Join(gitDir, "config")
+}
+
+// Open copies the configuration file at path, missing or not, to edit it. Close removes
+// the copy.
+func Open(path string) (*File, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, errors.New("git is not installed")
+	}
+	f := &File{path: path, mode: 0644}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if info, err := os.Stat(path); err == nil {
+		f.mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp("", "git-auth-gitconfig-*")
+	if err != nil {
+		return nil, err
+	}
+	defer tmp.Close()
+	if _, err := tmp.Write(data); err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	f.tmp = tmp.Name()
+	return f, nil
+}
+
+// Path returns the location of the file.
+func (f *File) Path() string {
+	return f.path
+}
+
+// Get returns the last value of key, empty when it is not set.
+func (f *File) Get(key string) (string, error) {
+	out, err := f.git(1, "--get", key)
+	return strings.TrimSuffix(out, "\n"), err
+}
+
+// GetRegexp returns the entries whose key matches the regular expression, keys being
+// lower case except for subsections.
+func (f *File) GetRegexp(pattern string) ([]Entry, error) {
+	out, err := f.git(1, "--null", "--get-regexp", pattern)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, item := range strings.Split(out, "\x00") {
+		if item == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(item, "\n")
+		entries = append(entries, Entry{Key: key, Value: value})
+	}
+	return entries, nil
+}
+
+// Set replaces every value of key with value.
+func (f *File) Set(key, value string) error {
+	_, err := f.git(0, "--replace-all", key, value)
+	return err
+}
+
+// Add adds a value to key, keeping the others.
+func (f *File) Add(key, value string) error {
+	_, err := f.git(0, "--add", key, value)
+	return err
+}
+
+// Unset removes every value of key. A missing key is not an error.
+func (f *File) Unset(key string) error {
+	_, err := f.git(5, "--unset-all", key)
+	return err
+}
+
+// RemoveSection removes a section with all its keys, such as url.git@host:group/.
+func (f *File) RemoveSection(name string) error {
+	_, err := f.git(0, "--remove-section", name)
+	return err
+}
+
+// Save writes the edited copy back to the file.
+func (f *File) Save(w *files.Writer) error {
+	data, err := os.ReadFile(f.tmp)
+	if err != nil {
+		return err
+	}
+	return w.WriteFile(f.path, data, f.mode)
+}
+
+// Close removes the copy.
+func (f *File) Close() error {
+	return os.Remove(f.tmp)
+}
+
+// git runs git config on the copy. The exit code allowed tells a missing key apart
+// from a failure, it is not an error.
+func (f *File) git(allowed int, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"config", "--file", f.tmp}, args...)...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && allowed != 0 && exitErr.ExitCode() == allowed {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("git config %s: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -28,6 +28,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 )
@@ -39,11 +40,33 @@ type requestDeviceAuthorization struct {
 
 type DeviceFlowResp struct {
 	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationUri         string `json:"verification_uri"`
 	VerificationUriComplete string `json:"verification_uri_complete"`
 	ExpireIn                int64  `json:"expire_in"`
 	Interval                int64  `json:"interval"`
 }
 
+// Code returns the code the user should see on the authorization page.
+func (r *DeviceFlowResp) Code() string {
+	if r.UserCode != "" {
+		return r.UserCode
+	}
+	if _, after, ok := strings.Cut(r.VerificationUriComplete, "="); ok {
+		return after
+	}
+	return ""
+}
+
+// DevicePrompt shows the user where to authorize the device.
+type DevicePrompt func(resp *DeviceFlowResp)
+
+// PrintDevicePrompt writes the authorization url and code of a device flow to w.
+func PrintDevicePrompt(w io.Writer, resp *DeviceFlowResp) {
+	fmt.Fprintf(w, "Visit the following URL to authorize the device: %s\nMake sure the code shown is %s\n",
+		resp.VerificationUriComplete, resp.Code())
+}
+
 type TokenResponse struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
@@ -145,23 +168,22 @@ func (glc *GitlabClient) PullToken(deviceCode string, interval time.Duration) (*
 	}
 }
 
-func (glc *GitlabClient) InitDeviceFlow() *TokenResponse {
+// DeviceFlow asks the user to authorize the device with prompt and waits for the
+// resulting token. A nil prompt prints the url and code to stderr, whatever the logger.
+func (glc *GitlabClient) DeviceFlow(prompt DevicePrompt) (*TokenResponse, error) {
 	deviceResp, err := glc.RequestDeviceAuthorization()
 	if err != nil {
-		glc.logger.Fatal("Error requesting device authorization: %w", err)
+		return nil, fmt.Errorf("Error requesting device authorization: %w", err)
+	}
+	if prompt == nil {
+		prompt = func(resp *DeviceFlowResp) { PrintDevicePrompt(os.Stderr, resp) }
 	}
-	code := strings.Split(deviceResp.VerificationUriComplete, "=")[1]
-	glc.logger.Info(`
-Welcome to Gl Auth
-Visit the following URL to authorize the device: %s
-Make sure to verify the code is correct.
-code is %s
-	`, deviceResp.VerificationUriComplete, code)
+	prompt(deviceResp)
 
 	tokenResp, err := glc.PullToken(deviceResp.DeviceCode, time.Duration(deviceResp.Interval)*time.Second)
 	if err != nil {
-		glc.logger.Fatal("Error pulling token: %w", err)
+		return nil, fmt.Errorf("Error pulling token: %w", err)
 	}
 	glc.token = tokenResp.AccessToken
-	return tokenResp
+	return tokenResp, nil
 }
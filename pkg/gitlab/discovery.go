@@ -0,0 +1,325 @@
+/*
+Copyright © 2024 Montasser abed majid zehri <montasser.zehri@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package gitlab
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RecommendedScopes are the scopes git-auth needs to manage keys, read the user
+// and serve git over HTTPS.
+var RecommendedScopes = []string{"api", "write_repository", "read_user"}
+
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// InstanceInfo is what Discover learned about a GitLab instance.
+type InstanceInfo struct {
+	Version string
+	SSHHost string
+	SSHPort int
+	// SSHGuessed is set when no public project gave the SSH address, so the host and
+	// port are guesses.
+	SSHGuessed bool
+	DeviceFlow bool
+	Scopes     []string
+	HostKeys   []HostKeyFingerprint
+}
+
+// HostKeyFingerprint is an SSH host key fingerprint published by the instance.
+type HostKeyFingerprint struct {
+	Algorithm string `json:"name"`
+	MD5       string `json:"md5"`
+	SHA256    string `json:"sha256"`
+}
+
+// instanceConfiguration is the JSON form of /help/instance_configuration.
+type instanceConfiguration struct {
+	SSHAlgorithmsHashes []HostKeyFingerprint `json:"ssh_algorithms_hashes"`
+	// Host is the host name of the instance, which GitLab Shell also uses for SSH
+	// unless configured otherwise, so it is only a guess of the SSH host
+	Host string `json:"host"`
+}
+
+type openIDConfiguration struct {
+	ScopesSupported             []string `json:"scopes_supported"`
+	GrantTypesSupported         []string `json:"grant_types_supported"`
+	DeviceAuthorizationEndpoint string   `json:"device_authorization_endpoint"`
+}
+
+var (
+	NotGitlabError = errors.New("not a GitLab instance")
+
+	sha256Fingerprint = regexp.MustCompile(`SHA256:[A-Za-z0-9+/]{43}`)
+)
+
+// Discover probes the public endpoints of the instance to find its version, SSH
+// address, device flow support, supported scopes and host key fingerprints.
+// Only an unreachable host or a host that does not look like GitLab is an error.
+func (glc *GitlabClient) Discover() (*InstanceInfo, error) {
+	info := &InstanceInfo{}
+
+	resp, err := glc.client.Get(fmt.Sprintf(API_VERSION, glc.Host))
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach %s: %w", glc.Host, err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var version struct {
+			Version string `json:"version"`
+		}
+		if err := json.Unmarshal(body, &version); err != nil {
+			return nil, NotGitlabError
+		}
+		info.Version = version.Version
+	case http.StatusUnauthorized, http.StatusForbidden:
+		// the version needs a token, the instance still answers like GitLab
+	default:
+		return nil, NotGitlabError
+	}
+
+	if oidc, err := glc.getOpenIDConfiguration(); err != nil {
+		glc.logger.Debug("openid configuration unavailable: %v", err)
+	} else {
+		info.Scopes = oidc.ScopesSupported
+		info.DeviceFlow = oidc.DeviceAuthorizationEndpoint != ""
+		for _, grant := range oidc.GrantTypesSupported {
+			if grant == deviceCodeGrantType {
+				info.DeviceFlow = true
+			}
+		}
+	}
+	if !info.DeviceFlow {
+		info.DeviceFlow = glc.probeDeviceFlow()
+	}
+
+	u, _ := url.Parse(glc.Host)
+	info.SSHHost, info.SSHPort, info.SSHGuessed = u.Hostname(), 22, true
+	if settings, body, err := glc.getInstanceConfiguration(); err != nil {
+		glc.logger.Debug("instance configuration unavailable: %v", err)
+	} else {
+		info.HostKeys = hostKeyFingerprints(settings, body)
+		if settings.Host != "" {
+			info.SSHHost = settings.Host
+		}
+	}
+	if host, port, err := glc.getSSHAddress(); err != nil {
+		glc.logger.Debug("no public project to read the SSH address from: %v", err)
+	} else {
+		info.SSHHost, info.SSHPort, info.SSHGuessed = host, port, false
+	}
+
+	return info, nil
+}
+
+// SuggestScopes returns the recommended scopes the instance supports.
+func (info *InstanceInfo) SuggestScopes() []string {
+	if len(info.Scopes) == 0 {
+		return RecommendedScopes
+	}
+	var scopes []string
+	for _, scope := range RecommendedScopes {
+		for _, supported := range info.Scopes {
+			if scope == supported {
+				scopes = append(scopes, scope)
+				break
+			}
+		}
+	}
+	return scopes
+}
+
+func (glc *GitlabClient) getOpenIDConfiguration() (*openIDConfiguration, error) {
+	resp, err := glc.client.Get(fmt.Sprintf(API_OPENID_CONFIGURATION, glc.Host))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	var oidc openIDConfiguration
+	if err := json.NewDecoder(resp.Body).Decode(&oidc); err != nil {
+		return nil, fmt.Errorf("failed to decode response body: %w", err)
+	}
+	return &oidc, nil
+}
+
+// probeDeviceFlow posts an empty device authorization request: instances without
+// device flow answer 404 while the others reject the missing client.
+func (glc *GitlabClient) probeDeviceFlow() bool {
+	resp, err := glc.client.Post(fmt.Sprintf(API_AUTHORIZE_DEVICE_PATH, glc.Host), "application/json", bytes.NewBufferString("{}"))
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode != http.StatusNotFound
+}
+
+// GetHostKeyFingerprints reads the SSH host key fingerprints from the instance
+// configuration, as JSON when available and scraped from the help page otherwise.
+func (glc *GitlabClient) GetHostKeyFingerprints() ([]HostKeyFingerprint, error) {
+	settings, body, err := glc.getInstanceConfiguration()
+	if err != nil {
+		return nil, err
+	}
+	keys := hostKeyFingerprints(settings, body)
+	if len(keys) == 0 {
+		return nil, errors.New("no host key fingerprint published")
+	}
+	return keys, nil
+}
+
+// getSSHAddress reads the SSH host and port from the clone address of a public project.
+func (glc *GitlabClient) getSSHAddress() (string, int, error) {
+	resp, err := glc.client.Get(fmt.Sprintf(API_PUBLIC_PROJECT, glc.Host))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	var projects []struct {
+		SSHURLToRepo string `json:"ssh_url_to_repo"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&projects); err != nil {
+		return "", 0, fmt.Errorf("failed to decode response body: %w", err)
+	}
+	if len(projects) == 0 || projects[0].SSHURLToRepo == "" {
+		return "", 0, errors.New("no public project")
+	}
+	return ParseSSHAddress(projects[0].SSHURLToRepo)
+}
+
+// ParseSSHAddress returns the host and port of an SSH clone address, either
+// ssh://git@host:port/path or the scp-like git@host:path.
+func ParseSSHAddress(address string) (string, int, error) {
+	if strings.HasPrefix(address, "ssh://") {
+		u, err := url.Parse(address)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid SSH address %q: %w", address, err)
+		}
+		port := 22
+		if u.Port() != "" {
+			if port, err = strconv.Atoi(u.Port()); err != nil {
+				return "", 0, fmt.Errorf("invalid SSH port in %q: %w", address, err)
+			}
+		}
+		return u.Hostname(), port, nil
+	}
+	hostPart, _, ok := strings.Cut(address, ":")
+	if !ok {
+		return "", 0, fmt.Errorf("invalid SSH address %q", address)
+	}
+	if i := strings.LastIndex(hostPart, "@"); i >= 0 {
+		hostPart = hostPart[i+1:]
+	}
+	return hostPart, 22, nil
+}
+
+// getInstanceConfiguration fetches /help/instance_configuration. The settings are empty
+// when the instance only serves the HTML page, the body is returned to scrape it.
+func (glc *GitlabClient) getInstanceConfiguration() (*instanceConfiguration, []byte, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf(API_INSTANCE_CONFIG, glc.Host), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := glc.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	settings := &instanceConfiguration{}
+	if err := json.Unmarshal(body, settings); err != nil {
+		settings = &instanceConfiguration{}
+	}
+	return settings, body, nil
+}
+
+// hostKeyFingerprints returns the fingerprints of the JSON settings, or the ones found in
+// the HTML page
+func hostKeyFingerprints(settings *instanceConfiguration, body []byte) []HostKeyFingerprint {
+	if len(settings.SSHAlgorithmsHashes) > 0 {
+		return settings.SSHAlgorithmsHashes
+	}
+	var keys []HostKeyFingerprint
+	for _, fingerprint := range sha256Fingerprint.FindAllString(string(body), -1) {
+		keys = append(keys, HostKeyFingerprint{SHA256: fingerprint})
+	}
+	return keys
+}
+
+// ConnectionInfo describes the HTTPS connection to an instance.
+type ConnectionInfo struct {
+	StatusCode int
+	// TLSVersion and the certificate fields are empty over plain http
+	TLSVersion  string
+	CertSubject string
+	CertIssuer  string
+	CertExpiry  time.Time
+}
+
+// CheckConnection requests the version endpoint without a token to check the
+// instance is reachable and report its TLS certificate.
+func (glc *GitlabClient) CheckConnection() (*ConnectionInfo, error) {
+	resp, err := glc.client.Get(fmt.Sprintf(API_VERSION, glc.Host))
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach %s: %w", glc.Host, err)
+	}
+	resp.Body.Close()
+
+	info := &ConnectionInfo{StatusCode: resp.StatusCode}
+	if resp.TLS != nil {
+		info.TLSVersion = tls.VersionName(resp.TLS.Version)
+		if len(resp.TLS.PeerCertificates) > 0 {
+			cert := resp.TLS.PeerCertificates[0]
+			info.CertSubject = cert.Subject.CommonName
+			info.CertIssuer = cert.Issuer.CommonName
+			info.CertExpiry = cert.NotAfter
+		}
+	}
+	return info, nil
+}
@@ -35,6 +35,11 @@ const (
 	API_USER_SSH_KEY_ID_PATH  = "%s/api/v4/user/keys/%d"
 	API_TOKEN_INFO            = "%s/oauth/token/info"
 	API_GET_USER              = "%s/api/v4/user"
+	API_USER_EMAILS           = "%s/api/v4/user/emails"
+	API_VERSION               = "%s/api/v4/version"
+	API_OPENID_CONFIGURATION  = "%s/.well-known/openid-configuration"
+	API_INSTANCE_CONFIG       = "%s/help/instance_configuration"
+	API_PUBLIC_PROJECT        = "%s/api/v4/projects?per_page=1&visibility=public&simple=true"
 )
 
 type GitlabClient struct {
@@ -43,18 +48,20 @@ type GitlabClient struct {
 	ClientId    string
 	client      *http.Client
 	SshPrefix   string
-	logger      *l.Logger
+	logger      l.Printer
 	token       string
 	redirectURI string
 }
 
-func New(host string, logger *l.Logger, ops ...Options) *GitlabClient {
+// New creates a client for the GitLab instance at host. Nothing is logged
+// unless a logger is given with WithLogger.
+func New(host string, ops ...Options) *GitlabClient {
 	glc := &GitlabClient{
 		Host: host,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		logger:      logger,
+		logger:      l.Discard,
 		redirectURI: "urn:ietf:wg:oauth:2.0:oob:auto",
 	}
 	for _, op := range ops {
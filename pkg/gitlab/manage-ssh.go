@@ -24,6 +24,7 @@ package gitlab
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -37,7 +38,8 @@ type CreateSSHKeyReq struct {
 	Key   string `json:"key"`
 }
 
-func (glc *GitlabClient) AddSSHKey(title, key string) error {
+// AddSSHKey uploads a public key to the account of the token and returns its GitLab ID.
+func (glc *GitlabClient) AddSSHKey(title, key string) (int, error) {
 	url := fmt.Sprintf(API_USER_SSH_KEY_PATH, glc.Host)
 	createKeyReq, err := json.Marshal(&CreateSSHKeyReq{
 		Title: title,
@@ -48,23 +50,30 @@ func (glc *GitlabClient) AddSSHKey(title, key string) error {
 	req, err := http.NewRequest("POST", url, createKeyReqBuffer)
 
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return 0, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", glc.token))
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := glc.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to execute request: %w", err)
+		return 0, fmt.Errorf("failed to execute request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("failed to add SSH key, status: %d", resp.StatusCode)
+		return 0, fmt.Errorf("failed to add SSH key, status: %d", resp.StatusCode)
+	}
+
+	var created struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return 0, fmt.Errorf("failed to decode response: %w", err)
 	}
 
 	glc.logger.Info("SSH key added successfully.")
-	return nil
+	return created.ID, nil
 }
 
 func (glc *GitlabClient) DeleteSSHKey(keyID int) error {
@@ -145,32 +154,46 @@ func (glc *GitlabClient) GetExpiredSSH() ([]map[string]interface{}, error) {
 	return expiredKeys, nil
 }
 
-func (glc *GitlabClient) DeleteSSHKeyByTitlePrefix(prefix string) {
+// DeleteSSHKeyByTitlePrefix deletes every key whose title starts with prefix. It returns
+// the keys that were deleted and the errors of the failed deletions joined together.
+func (glc *GitlabClient) DeleteSSHKeyByTitlePrefix(prefix string) ([]map[string]interface{}, error) {
 	existingKeys, err := glc.ListSSHKeys()
 	if err != nil {
-		glc.logger.Fatal("failed to list existing SSH keys: %w", err)
+		return nil, fmt.Errorf("failed to list existing SSH keys: %w", err)
 	}
 
-	var wg sync.WaitGroup
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		errs    []error
+		deleted []map[string]interface{}
+	)
 	for _, existingKey := range existingKeys {
 		if title, ok := existingKey["title"].(string); ok && strings.HasPrefix(title, prefix) {
 			wg.Add(1)
 			go func(key map[string]interface{}) {
 				defer wg.Done()
-				keyID, ok := existingKey["id"].(float64)
+				keyID, ok := key["id"].(float64)
 				if !ok {
 					glc.logger.Warn("Invalid key ID format")
+					return
 				}
 
-				err := glc.DeleteSSHKey(int(keyID))
-				if err != nil {
+				if err := glc.DeleteSSHKey(int(keyID)); err != nil {
 					glc.logger.Warn("Failed to delete key ID %d: %v", int(keyID), err)
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("key %d: %w", int(keyID), err))
+					mu.Unlock()
+					return
 				}
 				glc.logger.Info("Deleted existing SSH key with ID %d and title %s", int(keyID), title)
+				mu.Lock()
+				deleted = append(deleted, key)
+				mu.Unlock()
 			}(existingKey)
 
 		}
 	}
 	wg.Wait()
-
+	return deleted, errors.Join(errs...)
 }
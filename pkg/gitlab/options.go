@@ -24,6 +24,8 @@ package gitlab
 import (
 	"strings"
 	"time"
+
+	l "github.com/atnomoverflow/git-auth/pkg/logger"
 )
 
 type Options func(*GitlabClient)
@@ -46,6 +48,16 @@ func WithConnTimeout(timeout time.Duration) Options {
 	}
 }
 
+// WithLogger sets where the client logs, such as a *logger.Logger
+// or a slog.Logger adapted with logger.FromSlog.
+func WithLogger(logger l.Printer) Options {
+	return func(glc *GitlabClient) {
+		if logger != nil {
+			glc.logger = logger
+		}
+	}
+}
+
 func WithSshPrefix(prefix string) Options {
 	return func(glc *GitlabClient) {
 		glc.SshPrefix = prefix
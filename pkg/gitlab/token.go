@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
 type GitlabUser struct {
@@ -14,6 +15,68 @@ type GitlabUser struct {
 	Username string `json:"username"`
 	Name     string `json:"name"`
 	Email    string `json:"email"`
+	// CommitEmail is the address used for web commits, a verified email or the
+	// private noreply address
+	CommitEmail string `json:"commit_email"`
+}
+
+// GitlabEmail is a secondary email of the user.
+type GitlabEmail struct {
+	ID          int        `json:"id"`
+	Email       string     `json:"email"`
+	ConfirmedAt *time.Time `json:"confirmed_at"`
+}
+
+// Verified reports whether the user confirmed the email.
+func (e GitlabEmail) Verified() bool {
+	return e.ConfirmedAt != nil
+}
+
+// TokenInfo describes an access token as reported by the token info endpoint.
+type TokenInfo struct {
+	ResourceOwnerID  int      `json:"resource_owner_id"`
+	Scope            []string `json:"scope"`
+	ExpiresIn        int64    `json:"expires_in"`
+	ExpiresInSeconds int64    `json:"expires_in_seconds"`
+	CreatedAt        int64    `json:"created_at"`
+}
+
+// ExpiresAt returns the expiry time of the token relative to now. ok is false when the
+// token does not expire, GitLab then reporting no expires_in.
+func (ti *TokenInfo) ExpiresAt() (expiresAt time.Time, ok bool) {
+	expiresIn := ti.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = ti.ExpiresInSeconds
+	}
+	if expiresIn <= 0 {
+		return time.Time{}, false
+	}
+	return time.Now().Add(time.Duration(expiresIn) * time.Second), true
+}
+
+// GetTokenInfo returns the scopes and expiry of the given access token.
+func (glc *GitlabClient) GetTokenInfo(token string) (*TokenInfo, error) {
+	url := fmt.Sprintf(API_TOKEN_INFO, glc.Host)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	resp, err := glc.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var info TokenInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to decode response body: %w", err)
+	}
+	return &info, nil
 }
 
 func (glc *GitlabClient) VerifyToken(token string) (bool, error) {
@@ -66,6 +129,32 @@ func (glc *GitlabClient) GetUser(token string) (*GitlabUser, error) {
 	return &user, nil
 }
 
+// GetEmails returns the secondary emails of the user, the primary email of GetUser
+// not included.
+func (glc *GitlabClient) GetEmails() ([]GitlabEmail, error) {
+	url := fmt.Sprintf(API_USER_EMAILS, glc.Host)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", glc.token))
+
+	resp, err := glc.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list emails, status: %d", resp.StatusCode)
+	}
+
+	var emails []GitlabEmail
+	if err := json.NewDecoder(resp.Body).Decode(&emails); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return emails, nil
+}
+
 // RefreshToken refreshes the OAuth token.
 func (glc *GitlabClient) RefreshToken(refreshToken string) (*TokenResponse, error) {
 	// Endpoint for refreshing the token.
@@ -111,3 +200,8 @@ func (glc *GitlabClient) RefreshToken(refreshToken string) (*TokenResponse, erro
 func (glc *GitlabClient) SetToken(token string) {
 	glc.token = token
 }
+
+// Token returns the access token the client authenticates with, empty before login.
+func (glc *GitlabClient) Token() string {
+	return glc.token
+}
@@ -24,22 +24,22 @@ package logger
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
 	"github.com/rs/zerolog"
 )
 
+// ILogger is a Printer that can also stop the program, for use in commands.
 type ILogger interface {
-	Debug(message interface{}, args ...interface{})
-	Info(message string, args ...interface{})
-	Warn(message string, args ...interface{})
-	Error(message interface{}, args ...interface{})
+	Printer
 	Fatal(message interface{}, args ...interface{})
 }
 
 type Logger struct {
 	logger *zerolog.Logger
+	opts   options
 }
 
 var _ ILogger = (*Logger)(nil)
@@ -94,13 +94,87 @@ func (f *LogLevel) SetValue(s string) error {
 	case "FATAL":
 		*f = FATAL
 	default:
-		fmt.Printf("%s unknown log level. falling down to INFO", s)
-		*f = INFO
+		return fmt.Errorf("unknown log level %q. choose between [\"DEBUG\", \"INFO\", \"WARN\", \"ERROR\", \"FATAL\"]", s)
+	}
+	return nil
+}
+
+// Format is the encoding of the log records.
+type Format int
+
+const (
+	CONSOLE Format = iota
+	JSON
+)
+
+func (f Format) String() string {
+	return [...]string{"console", "json"}[f]
+}
+
+func (f *Format) SetValue(s string) error {
+	switch strings.ToLower(s) {
+	case "console", "":
+		*f = CONSOLE
+	case "json":
+		*f = JSON
+	default:
+		return fmt.Errorf("unknown log format %q. choose between [\"console\", \"json\"]", s)
 	}
 	return nil
 }
 
-func New(lvl LogLevel) *Logger {
+type options struct {
+	out      io.Writer
+	format   Format
+	color    bool
+	redactor *Redactor
+}
+
+type Options func(*options)
+
+// WithOutput sets where the logs are written, stderr by default.
+func WithOutput(w io.Writer) Options {
+	return func(o *options) {
+		o.out = w
+	}
+}
+
+// WithFormat sets the encoding of the logs, console by default.
+func WithFormat(format Format) Options {
+	return func(o *options) {
+		o.format = format
+	}
+}
+
+// WithColor enables colors in console logs.
+func WithColor(color bool) Options {
+	return func(o *options) {
+		o.color = color
+	}
+}
+
+// WithRedactor sets the Redactor masking secrets in the logs. By default
+// a Redactor with the DefaultPatterns is used.
+func WithRedactor(r *Redactor) Options {
+	return func(o *options) {
+		o.redactor = r
+	}
+}
+
+// New creates a Logger writing records of lvl and above. Without options it
+// writes colored console logs to stderr.
+func New(lvl LogLevel, ops ...Options) *Logger {
+	o := &options{
+		out:   os.Stderr,
+		color: true,
+	}
+	for _, op := range ops {
+		op(o)
+	}
+	if o.redactor == nil {
+		o.redactor = NewRedactor()
+	}
+
 	var l zerolog.Level
 	switch lvl {
 	case DEBUG:
@@ -117,17 +191,42 @@ func New(lvl LogLevel) *Logger {
 
 	zerolog.SetGlobalLevel(l)
 
-	logger := zerolog.New(zerolog.NewConsoleWriter(func(w *zerolog.ConsoleWriter) {
-		w.Out = os.Stdout
-		w.NoColor = false
-		
-	})).With().Timestamp().Logger()
+	logger := zerolog.New(o.writer()).With().Timestamp().Logger()
 
 	return &Logger{
 		logger: &logger,
+		opts:   *o,
 	}
 }
 
+func (o *options) writer() io.Writer {
+	out := o.redactor.Writer(o.out)
+	if o.format == JSON {
+		return out
+	}
+	return zerolog.NewConsoleWriter(func(w *zerolog.ConsoleWriter) {
+		w.Out = out
+		w.NoColor = !o.color
+	})
+}
+
+// AddSecret masks the given values in every following log record.
+func (l *Logger) AddSecret(secrets ...string) {
+	l.opts.redactor.AddSecret(secrets...)
+}
+
+// Redact masks the secrets of s the way log records are, for text written elsewhere.
+func (l *Logger) Redact(s string) string {
+	return l.opts.redactor.Redact(s)
+}
+
+// SetOutput redirects the log output to w, keeping the level and context.
+func (l *Logger) SetOutput(w io.Writer) {
+	l.opts.out = w
+	logger := l.logger.Output(l.opts.writer())
+	l.logger = &logger
+}
+
 func (l *Logger) Debug(message interface{}, args ...interface{}) {
 	l.msg(DEBUG, message, args...)
 }
@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Printer is the logging interface the library packages depend on. Unlike
+// ILogger it cannot exit the process, errors are returned to the caller instead.
+type Printer interface {
+	Debug(message interface{}, args ...interface{})
+	Info(message string, args ...interface{})
+	Warn(message string, args ...interface{})
+	Error(message interface{}, args ...interface{})
+}
+
+var _ Printer = (*Logger)(nil)
+
+// Discard is a Printer dropping every message, used when no logger is given.
+var Discard Printer = discard{}
+
+type discard struct{}
+
+func (discard) Debug(message interface{}, args ...interface{}) {}
+func (discard) Info(message string, args ...interface{})       {}
+func (discard) Warn(message string, args ...interface{})       {}
+func (discard) Error(message interface{}, args ...interface{}) {}
+
+// FromSlog adapts a slog.Logger, and so any slog.Handler, to a Printer. Messages are
+// formatted with their arguments and error messages get the error as an attribute.
+func FromSlog(logger *slog.Logger) Printer {
+	return &slogPrinter{logger: logger}
+}
+
+type slogPrinter struct {
+	logger *slog.Logger
+}
+
+func (p *slogPrinter) Debug(message interface{}, args ...interface{}) {
+	p.log(slog.LevelDebug, message, args...)
+}
+
+func (p *slogPrinter) Info(message string, args ...interface{}) {
+	p.log(slog.LevelInfo, message, args...)
+}
+
+func (p *slogPrinter) Warn(message string, args ...interface{}) {
+	p.log(slog.LevelWarn, message, args...)
+}
+
+func (p *slogPrinter) Error(message interface{}, args ...interface{}) {
+	p.log(slog.LevelError, message, args...)
+}
+
+func (p *slogPrinter) log(level slog.Level, message interface{}, args ...interface{}) {
+	ctx := context.Background()
+	if !p.logger.Enabled(ctx, level) {
+		return
+	}
+	switch msg := message.(type) {
+	case error:
+		p.logger.LogAttrs(ctx, level, format(msg.Error(), args...), slog.Any("error", msg))
+	case string:
+		p.logger.LogAttrs(ctx, level, format(msg, args...))
+	default:
+		p.logger.LogAttrs(ctx, level, fmt.Sprint(message))
+	}
+}
+
+func format(message string, args ...interface{}) string {
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
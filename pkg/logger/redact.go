@@ -0,0 +1,122 @@
+package logger
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Mask replaces the secrets removed from the logs.
+const Mask = "[REDACTED]"
+
+// minSecretLength keeps short values such as profile names from being masked everywhere.
+const minSecretLength = 8
+
+// DefaultPatterns match the secrets git-auth handles. When a pattern has a group
+// named secret only that group is masked, otherwise the whole match is.
+var DefaultPatterns = []*regexp.Regexp{
+	// PEM private keys, raw or with escaped new lines
+	regexp.MustCompile(`(?s)-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----.*?-----END [A-Z0-9 ]*PRIVATE KEY-----`),
+	// GitLab prefixed tokens such as glpat- or glrt-
+	regexp.MustCompile(`\bgl[a-z]{1,6}-[0-9A-Za-z_\-]{20,}`),
+	// OAuth responses, query strings and dumped structs
+	regexp.MustCompile(`(?i)\b(?:access_?token|refresh_?token|id_?token|device_?code|client_?secret|private_?token|password)\\?"?\s*[:=]\s*\\?"?(?P<secret>[^\s"\\&,}\]]+)`),
+	// Authorization and PRIVATE-TOKEN headers
+	regexp.MustCompile(`(?i)\b(?:authorization|private-token)\\?"?\s*[:=]\s*\[?\\?"?(?:(?:bearer|basic|token)\s+)?(?P<secret>[^\s"\\,\]]+)`),
+	regexp.MustCompile(`(?i)\bbearer\s+(?P<secret>[A-Za-z0-9._~+/\-]+=*)`),
+}
+
+// Redactor masks secrets in log records before they are written.
+type Redactor struct {
+	mu       sync.RWMutex
+	patterns []*regexp.Regexp
+	secrets  []string
+}
+
+// NewRedactor returns a Redactor using the default patterns and the extra ones.
+func NewRedactor(patterns ...*regexp.Regexp) *Redactor {
+	r := &Redactor{}
+	r.patterns = append(r.patterns, DefaultPatterns...)
+	r.patterns = append(r.patterns, patterns...)
+	return r
+}
+
+// AddPattern masks the matches of another pattern.
+func (r *Redactor) AddPattern(pattern *regexp.Regexp) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.patterns = append(r.patterns, pattern)
+}
+
+// AddSecret masks every occurrence of the given values, such as a token read from the store.
+func (r *Redactor) AddSecret(secrets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, secret := range secrets {
+		if len(secret) < minSecretLength {
+			continue
+		}
+		known := false
+		for _, s := range r.secrets {
+			if s == secret {
+				known = true
+				break
+			}
+		}
+		if !known {
+			r.secrets = append(r.secrets, secret)
+		}
+	}
+}
+
+// Redact returns s with the secrets masked.
+func (r *Redactor) Redact(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, Mask)
+	}
+	for _, pattern := range r.patterns {
+		s = redactPattern(pattern, s)
+	}
+	return s
+}
+
+func redactPattern(pattern *regexp.Regexp, s string) string {
+	group := pattern.SubexpIndex("secret")
+	if group < 0 {
+		return pattern.ReplaceAllLiteralString(s, Mask)
+	}
+	var sb strings.Builder
+	last := 0
+	for _, m := range pattern.FindAllStringSubmatchIndex(s, -1) {
+		start, end := m[2*group], m[2*group+1]
+		if start < 0 || strings.HasPrefix(s[start:], Mask) {
+			continue
+		}
+		sb.WriteString(s[last:start])
+		sb.WriteString(Mask)
+		last = end
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
+
+// Writer returns a writer masking the secrets of each record before writing it to w.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	return &redactWriter{redactor: r, out: w}
+}
+
+type redactWriter struct {
+	redactor *Redactor
+	out      io.Writer
+}
+
+// Write expects a whole record per call, which is how zerolog writes.
+func (w *redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.out, w.redactor.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,175 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// How the host key presented by the server compares with the known_hosts files.
+const (
+	HostKeyKnown    = "known"
+	HostKeyUnknown  = "unknown"
+	HostKeyMismatch = "mismatch"
+)
+
+// ConnectResult describes the server a manager connected to.
+type ConnectResult struct {
+	HostKey ssh.PublicKey
+	// HostKeyStatus is HostKeyKnown, HostKeyUnknown or HostKeyMismatch
+	HostKeyStatus string
+	// KnownHostsFiles are the files the host key was looked up in
+	KnownHostsFiles []string
+}
+
+// Signer reads the private key of the manager's key pair.
+func (cfg *SSHManager) Signer() (ssh.Signer, error) {
+	data, err := os.ReadFile(filepath.Join(cfg.path, cfg.keyName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	return signer, nil
+}
+
+// Address returns the host and port the manager connects to.
+func (cfg *SSHManager) Address() string {
+	return net.JoinHostPort(cfg.host, strconv.Itoa(cfg.port))
+}
+
+// knownHostsAddress returns the name the host keys are recorded under in known_hosts,
+// the HostKeyAlias when there is one as ssh does.
+func (cfg *SSHManager) knownHostsAddress() string {
+	if cfg.hostOptions.HostKeyAlias != "" {
+		return net.JoinHostPort(cfg.hostOptions.HostKeyAlias, "22")
+	}
+	return cfg.Address()
+}
+
+// user returns the user the manager connects as, git unless the host options set one.
+func (cfg *SSHManager) user() string {
+	if cfg.hostOptions.User != "" {
+		return cfg.hostOptions.User
+	}
+	return "git"
+}
+
+// Connect authenticates to the host with the manager's key, as git unless the host
+// options set another user. The host key is looked up in the user and system
+// known_hosts files and reported in the result, the connection is not refused when
+// it is unknown. The caller closes the client.
+func (cfg *SSHManager) Connect(timeout time.Duration) (*ssh.Client, *ConnectResult, error) {
+	return cfg.connect(timeout, false)
+}
+
+// connect is Connect, refusing host keys that are not known when strict before the
+// key authenticates
+func (cfg *SSHManager) connect(timeout time.Duration, strict bool) (*ssh.Client, *ConnectResult, error) {
+	signer, err := cfg.Signer()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := &ConnectResult{KnownHostsFiles: cfg.knownHostsFiles()}
+	var check ssh.HostKeyCallback
+	if len(result.KnownHostsFiles) > 0 {
+		check, err = knownhosts.New(result.KnownHostsFiles...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read known_hosts: %w", err)
+		}
+	}
+	clientConfig := &ssh.ClientConfig{
+		User: cfg.user(),
+		Auth: []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			result.HostKey = key
+			result.HostKeyStatus = hostKeyStatus(check, cfg.knownHostsAddress(), remote, key)
+			if strict && result.HostKeyStatus != HostKeyKnown {
+				return fmt.Errorf("the host key of %s is %s in known_hosts, add the verified keys with git-auth known-hosts", cfg.Address(), result.HostKeyStatus)
+			}
+			return nil
+		},
+		Timeout: timeout,
+	}
+
+	client, err := ssh.Dial("tcp", cfg.Address(), clientConfig)
+	if err != nil {
+		return nil, result, fmt.Errorf("failed to connect to %s: %w", cfg.Address(), err)
+	}
+	cfg.logger.Debug("connected to %s as %s, host key %s", cfg.Address(), cfg.user(), result.HostKeyStatus)
+	return client, result, nil
+}
+
+// knownHostsFiles returns the existing known_hosts files ssh reads for the host.
+func (cfg *SSHManager) knownHostsFiles() []string {
+	files := []string{defaultKnownHostsFile(), "/etc/ssh/ssh_known_hosts"}
+	if cfg.KnownHostsFile() != defaultKnownHostsFile() {
+		files = append(files, cfg.KnownHostsFile())
+	}
+
+	var existing []string
+	for _, file := range files {
+		if _, err := os.Stat(file); err == nil {
+			existing = append(existing, file)
+		}
+	}
+	return existing
+}
+
+var welcomePattern = regexp.MustCompile(`Welcome to GitLab, @([^\s!]+)!`)
+
+// Verify connects with the manager's key and reads the welcome message GitLab
+// answers a shell request with. It returns the user the key authenticates as
+// and fails when it is not expectedUser, or when the host key is not in known_hosts
+// as anyone could print the message.
+func (cfg *SSHManager) Verify(expectedUser string, timeout time.Duration) (string, error) {
+	client, _, err := cfg.connect(timeout, true)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to open a session: %w", err)
+	}
+	defer session.Close()
+	var output bytes.Buffer
+	session.Stdout = &output
+	session.Stderr = &output
+	if err := session.Shell(); err != nil {
+		return "", fmt.Errorf("failed to start a shell: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		// the message is sent right away, a server still waiting is not GitLab
+		session.Close()
+		<-done
+	}
+
+	m := welcomePattern.FindStringSubmatch(output.String())
+	if m == nil {
+		return "", fmt.Errorf("%s did not answer with the GitLab welcome message: %q", cfg.Address(), strings.TrimSpace(output.String()))
+	}
+	cfg.logger.Debug("%s welcomed @%s", cfg.Address(), m[1])
+	if expectedUser != "" && m[1] != expectedUser {
+		return m[1], fmt.Errorf("the key authenticates as @%s instead of @%s", m[1], expectedUser)
+	}
+	return m[1], nil
+}
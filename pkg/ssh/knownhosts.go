@@ -0,0 +1,283 @@
+package ssh
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// hostKeyAlgorithms are negotiated one at a time so the server presents each of its keys.
+var hostKeyAlgorithms = []string{
+	ssh.KeyAlgoED25519,
+	ssh.KeyAlgoECDSA256,
+	ssh.KeyAlgoECDSA384,
+	ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA512,
+}
+
+var errHostKeyCaptured = errors.New("host key captured")
+
+// HostKeyMismatchError is returned when a host key is not one of the expected ones.
+type HostKeyMismatchError struct {
+	Address     string
+	Fingerprint string
+	Expected    []string
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf("host key %s of %s is not one of the expected fingerprints %s",
+		e.Fingerprint, e.Address, strings.Join(e.Expected, ", "))
+}
+
+// KnownHostsFile returns the known_hosts file host keys are written to.
+func (cfg *SSHManager) KnownHostsFile() string {
+	if cfg.knownHostsFile != "" {
+		return cfg.knownHostsFile
+	}
+	return defaultKnownHostsFile()
+}
+
+func defaultKnownHostsFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
+
+// Keyscan fetches the host keys of the manager's host without authenticating, like
+// ssh-keyscan. Each supported key type is requested in its own connection.
+func (cfg *SSHManager) Keyscan(timeout time.Duration) ([]ssh.PublicKey, error) {
+	var keys []ssh.PublicKey
+	seen := map[string]bool{}
+	for _, algorithm := range hostKeyAlgorithms {
+		var captured ssh.PublicKey
+		clientConfig := &ssh.ClientConfig{
+			User:              "git",
+			HostKeyAlgorithms: []string{algorithm},
+			HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+				captured = key
+				return errHostKeyCaptured
+			},
+			Timeout: timeout,
+		}
+		client, err := ssh.Dial("tcp", cfg.Address(), clientConfig)
+		if err == nil {
+			client.Close()
+		}
+		var netErr *net.OpError
+		if captured == nil && errors.As(err, &netErr) {
+			return nil, fmt.Errorf("failed to connect to %s: %w", cfg.Address(), err)
+		}
+		if captured == nil {
+			cfg.logger.Debug("%s does not offer a %s host key: %v", cfg.Address(), algorithm, err)
+			continue
+		}
+		if fingerprint := ssh.FingerprintSHA256(captured); !seen[fingerprint] {
+			seen[fingerprint] = true
+			keys = append(keys, captured)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s offered no supported host key", cfg.Address())
+	}
+	return keys, nil
+}
+
+// CheckHostKeys makes sure every key has one of the expected SHA256 fingerprints.
+func (cfg *SSHManager) CheckHostKeys(keys []ssh.PublicKey, expected []string) error {
+	want := map[string]bool{}
+	for _, fingerprint := range expected {
+		want[fingerprint] = true
+	}
+	for _, key := range keys {
+		if fingerprint := ssh.FingerprintSHA256(key); !want[fingerprint] {
+			return &HostKeyMismatchError{Address: cfg.Address(), Fingerprint: fingerprint, Expected: expected}
+		}
+	}
+	return nil
+}
+
+// AddKnownHosts appends hashed entries for the keys of the manager's host to its
+// known_hosts file and returns how many were added. Keys already known are skipped
+// and a different key of the same type already recorded for the host is an error.
+func (cfg *SSHManager) AddKnownHosts(keys []ssh.PublicKey) (int, error) {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	file := cfg.KnownHostsFile()
+	if file == "" {
+		return 0, errors.New("failed to find the known_hosts file")
+	}
+	var check ssh.HostKeyCallback
+	existing, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	if err == nil {
+		if check, err = knownhosts.New(file); err != nil {
+			return 0, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+	}
+
+	remote, err := net.ResolveTCPAddr("tcp", cfg.Address())
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve %s: %w", cfg.Address(), err)
+	}
+	var lines []string
+	for _, key := range keys {
+		switch hostKeyStatus(check, cfg.knownHostsAddress(), remote, key) {
+		case HostKeyKnown:
+			continue
+		case HostKeyMismatch:
+			return 0, fmt.Errorf("%s already has a different %s key for %s, remove it with ssh-keygen -R if the change is expected",
+				file, key.Type(), cfg.knownHostsAddress())
+		}
+		host := knownhosts.HashHostname(knownhosts.Normalize(cfg.knownHostsAddress()))
+		lines = append(lines, knownhosts.Line([]string{host}, key))
+	}
+	if len(lines) == 0 {
+		return 0, nil
+	}
+
+	content := string(existing)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += strings.Join(lines, "\n") + "\n"
+	perm := os.FileMode(0600)
+	if info, err := os.Stat(file); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if err := cfg.files.WriteFile(file, []byte(content), perm); err != nil {
+		return 0, err
+	}
+	cfg.logger.Debug("added %d host keys of %s to %s", len(lines), cfg.Address(), file)
+	return len(lines), nil
+}
+
+// KnownHostsEntries returns how many entries of the known_hosts file name the host.
+func (cfg *SSHManager) KnownHostsEntries() (int, error) {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	_, removed, _, err := cfg.withoutKnownHosts()
+	return removed, err
+}
+
+// RemoveKnownHosts removes the host from the entries of the known_hosts file, dropping
+// the entries naming no other host, and returns how many entries named it.
+func (cfg *SSHManager) RemoveKnownHosts() (int, error) {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	lines, removed, mode, err := cfg.withoutKnownHosts()
+	if err != nil || removed == 0 {
+		return removed, err
+	}
+	content := ""
+	if len(lines) > 0 {
+		content = strings.Join(lines, "\n") + "\n"
+	}
+	if err := cfg.files.WriteFile(cfg.KnownHostsFile(), []byte(content), mode); err != nil {
+		return 0, err
+	}
+	cfg.logger.Debug("removed %d entries of %s from %s", removed, cfg.knownHostsAddress(), cfg.KnownHostsFile())
+	return removed, nil
+}
+
+// withoutKnownHosts returns the lines of the known_hosts file without the host and
+// the number of entries that named it.
+func (cfg *SSHManager) withoutKnownHosts() ([]string, int, os.FileMode, error) {
+	file := cfg.KnownHostsFile()
+	info, err := os.Stat(file)
+	if os.IsNotExist(err) {
+		return nil, 0, 0, nil
+	}
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	host := knownhosts.Normalize(cfg.knownHostsAddress())
+	var lines []string
+	removed := 0
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		fields := strings.Fields(line)
+		i := 0
+		if len(fields) > 0 && strings.HasPrefix(fields[0], "@") {
+			i = 1
+		}
+		if len(fields) <= i || strings.HasPrefix(fields[0], "#") {
+			lines = append(lines, line)
+			continue
+		}
+		var kept []string
+		for _, pattern := range strings.Split(fields[i], ",") {
+			if !matchesKnownHost(pattern, host) {
+				kept = append(kept, pattern)
+			}
+		}
+		if len(kept) == len(strings.Split(fields[i], ",")) {
+			lines = append(lines, line)
+			continue
+		}
+		removed++
+		if len(kept) > 0 {
+			fields[i] = strings.Join(kept, ",")
+			lines = append(lines, strings.Join(fields, " "))
+		}
+	}
+	return lines, removed, info.Mode().Perm(), nil
+}
+
+// matchesKnownHost reports whether a host pattern of a known_hosts entry, plain or
+// hashed, is exactly host. Wildcard patterns are not matched.
+func matchesKnownHost(pattern, host string) bool {
+	salt64, hash64, ok := strings.Cut(strings.TrimPrefix(pattern, "|1|"), "|")
+	if !strings.HasPrefix(pattern, "|1|") || !ok {
+		return pattern == host
+	}
+	salt, err := base64.StdEncoding.DecodeString(salt64)
+	if err != nil {
+		return false
+	}
+	hash, err := base64.StdEncoding.DecodeString(hash64)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+	return hmac.Equal(mac.Sum(nil), hash)
+}
+
+// hostKeyStatus compares a key with the known keys of the host. A key of a type
+// that is not recorded yet is unknown rather than a mismatch.
+func hostKeyStatus(check ssh.HostKeyCallback, hostname string, remote net.Addr, key ssh.PublicKey) string {
+	if check == nil {
+		return HostKeyUnknown
+	}
+	err := check(hostname, remote, key)
+	if err == nil {
+		return HostKeyKnown
+	}
+	var keyErr *knownhosts.KeyError
+	if errors.As(err, &keyErr) {
+		for _, known := range keyErr.Want {
+			if known.Key.Type() == key.Type() {
+				return HostKeyMismatch
+			}
+		}
+	}
+	return HostKeyUnknown
+}
@@ -11,6 +11,8 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/atnomoverflow/git-auth/pkg/files"
+	l "github.com/atnomoverflow/git-auth/pkg/logger"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -19,8 +21,84 @@ type SSHManager struct {
 	keyName string
 	path    string
 	port    int
+	logger  l.Printer
+	// knownHostsFile is empty for ~/.ssh/known_hosts
+	knownHostsFile string
+	// configFile is empty for ~/.ssh/config.d/git-auth
+	configFile  string
+	hostOptions HostOptions
+	files       *files.Writer
 }
 
+// HostOptions are the settings of the generated Host block besides HostName, Port
+// and IdentityFile. Empty values are left out of the block.
+type HostOptions struct {
+	// Alias is the Host name of the block, the host itself when empty
+	Alias          string
+	User           string
+	IdentitiesOnly bool
+	IdentityAgent  string
+	ProxyJump      string
+	ControlMaster  string
+	ControlPersist string
+	HostKeyAlias   string
+	// Extra are "Keyword value" lines added at the end of the block
+	Extra []string
+	// Template is a text/template file rendering the whole block instead of the built-in one
+	Template string
+}
+
+// HostEntry is the data a Host block template is rendered with.
+type HostEntry struct {
+	Host           string
+	HostName       string
+	Port           int
+	User           string
+	IdentityFile   string
+	IdentitiesOnly bool
+	IdentityAgent  string
+	ProxyJump      string
+	ControlMaster  string
+	ControlPersist string
+	HostKeyAlias   string
+	KnownHostsFile string
+	Options        []string
+}
+
+// hostTemplate is the built-in Host block template
+const hostTemplate = `Host {{.Host}}
+    HostName {{.HostName}}
+    Port {{.Port}}
+{{- if .User}}
+    User {{.User}}
+{{- end}}
+    IdentityFile {{.IdentityFile}}
+{{- if .IdentitiesOnly}}
+    IdentitiesOnly yes
+{{- end}}
+{{- if .IdentityAgent}}
+    IdentityAgent {{.IdentityAgent}}
+{{- end}}
+{{- if .ProxyJump}}
+    ProxyJump {{.ProxyJump}}
+{{- end}}
+{{- if .ControlMaster}}
+    ControlMaster {{.ControlMaster}}
+{{- end}}
+{{- if .ControlPersist}}
+    ControlPersist {{.ControlPersist}}
+{{- end}}
+{{- if .HostKeyAlias}}
+    HostKeyAlias {{.HostKeyAlias}}
+{{- end}}
+{{- if .KnownHostsFile}}
+    UserKnownHostsFile ~/.ssh/known_hosts {{.KnownHostsFile}}
+{{- end}}
+{{- range .Options}}
+    {{.}}
+{{- end}}
+`
+
 // New creates a new instance of SSHManager with optional configurations.
 func New(host string, ops ...Options) *SSHManager {
 	sshConfig := &SSHManager{
@@ -28,6 +106,8 @@ func New(host string, ops ...Options) *SSHManager {
 		port:    22,
 		path:    "~/.ssh",
 		keyName: "id_rsa",
+		logger:  l.Discard,
+		files:   files.New(),
 	}
 
 	for _, op := range ops {
@@ -36,98 +116,302 @@ func New(host string, ops ...Options) *SSHManager {
 	return sshConfig
 }
 
-// AddSSHConfig generates and appends or updates the SSH config.
-func (cfg *SSHManager) AddSSHConfig() error {
+// ConfigPath returns the path of the user's SSH config, ~/.ssh/config.
+func ConfigPath() (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
-		return fmt.Errorf("failed to get user home directory: %w", err)
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
 	}
+	return filepath.Join(home, ".ssh", "config"), nil
+}
 
-	sshConfigPath := filepath.Join(home, ".ssh", "config")
-	if err := os.MkdirAll(filepath.Dir(sshConfigPath), os.ModePerm); err != nil {
-		return fmt.Errorf("failed to create .ssh directory: %w", err)
+// Alias returns the Host name of the generated block.
+func (cfg *SSHManager) Alias() string {
+	if cfg.hostOptions.Alias != "" {
+		return cfg.hostOptions.Alias
 	}
+	return cfg.host
+}
 
-	// SSH Config Template
-	templateFile := `Host {{.Host}}
-    HostName {{.HostName}}
-    Port {{.Port}}
-    IdentityFile {{.IdentityFile}}
-`
-	// Set up SSH config details
-	sshConfig := struct {
-		Host         string
-		HostName     string
-		Port         int
-		IdentityFile string
-	}{
-		Host:         cfg.host,
-		HostName:     cfg.host,
-		Port:         cfg.port,
-		IdentityFile: filepath.Join(cfg.path, cfg.keyName),
+// ConfigBlock renders the SSH config entry of the host with the built-in template, or
+// the template file of the host options. The block must define only Host <alias>.
+func (cfg *SSHManager) ConfigBlock() (string, error) {
+	entry := HostEntry{
+		Host:           cfg.Alias(),
+		HostName:       cfg.host,
+		Port:           cfg.port,
+		User:           cfg.hostOptions.User,
+		IdentityFile:   filepath.Join(cfg.path, cfg.keyName),
+		IdentitiesOnly: cfg.hostOptions.IdentitiesOnly,
+		IdentityAgent:  cfg.hostOptions.IdentityAgent,
+		ProxyJump:      cfg.hostOptions.ProxyJump,
+		ControlMaster:  cfg.hostOptions.ControlMaster,
+		ControlPersist: cfg.hostOptions.ControlPersist,
+		HostKeyAlias:   cfg.hostOptions.HostKeyAlias,
+		Options:        cfg.hostOptions.Extra,
+	}
+	if file := cfg.KnownHostsFile(); file != defaultKnownHostsFile() {
+		entry.KnownHostsFile = file
+	}
+	values := append([]string{entry.Host, entry.User, entry.IdentityAgent, entry.ProxyJump,
+		entry.ControlMaster, entry.ControlPersist, entry.HostKeyAlias}, entry.Options...)
+	for _, value := range values {
+		if strings.ContainsAny(value, "\r\n") {
+			return "", fmt.Errorf("SSH option %q must fit on one line", value)
+		}
 	}
 
-	// Parse the embedded template
-	tmpl, err := template.New("sshConfig").Parse(templateFile)
+	text, name := hostTemplate, "sshConfig"
+	if cfg.hostOptions.Template != "" {
+		data, err := os.ReadFile(cfg.hostOptions.Template)
+		if err != nil {
+			return "", fmt.Errorf("failed to read SSH config template: %w", err)
+		}
+		text, name = string(data), filepath.Base(cfg.hostOptions.Template)
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
 	if err != nil {
-		return fmt.Errorf("error parsing template: %v", err)
+		return "", fmt.Errorf("error parsing template: %v", err)
 	}
-
-	// Apply the template to generate the config
 	var sb strings.Builder
-	if err := tmpl.Execute(&sb, sshConfig); err != nil {
-		return fmt.Errorf("error applying template: %v", err)
+	if err := tmpl.Execute(&sb, entry); err != nil {
+		return "", fmt.Errorf("error applying template: %v", err)
 	}
 
-	// Create the new configuration to insert into the file
-	newConfig := sb.String()
+	block := &ConfigFile{lines: strings.Split(strings.TrimRight(sb.String(), "\n"), "\n")}
+	blocks := block.blocks()
+	if len(blocks) != 1 || blocks[0].start != firstDirective(block.lines) || !blocks[0].has(entry.Host) {
+		return "", fmt.Errorf("the SSH config template must render a single Host %s block", entry.Host)
+	}
+	return sb.String(), nil
+}
 
-	// Read the existing SSH config file (if exists)
-	sshConfigFile, err := os.ReadFile(sshConfigPath)
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("error reading SSH config file: %v", err)
+// firstDirective returns the index of the first line that is not blank or a comment.
+func firstDirective(lines []string) int {
+	for i, line := range lines {
+		if keyword, _ := directive(line); keyword != "" {
+			return i
+		}
 	}
+	return -1
+}
 
-	// Convert file content to string for easier processing
-	sshConfigContent := string(sshConfigFile)
+// ConfigFile returns the file holding the managed Host blocks.
+func (cfg *SSHManager) ConfigFile() string {
+	if cfg.configFile != "" {
+		return cfg.configFile
+	}
+	sshConfigPath, err := ConfigPath()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(sshConfigPath), "config.d", "git-auth")
+}
 
-	// Define a unique header using the host as an identifier
-	headerTag := fmt.Sprintf("# BEGIN GENERATED CONFIG FOR %s", cfg.host)
-	footerTag := fmt.Sprintf("# END GENERATED CONFIG FOR %s", cfg.host)
+// CurrentConfigBlock returns the Host block of the host as it is in the managed file,
+// or between the markers older versions wrote to ~/.ssh/config, empty when there is none.
+func (cfg *SSHManager) CurrentConfigBlock() (string, error) {
+	managed, err := ReadConfigFile(cfg.ConfigFile())
+	if err != nil {
+		return "", err
+	}
+	if block := managed.HostBlock(cfg.Alias()); block != "" {
+		return block, nil
+	}
+	sshConfigPath, err := ConfigPath()
+	if err != nil {
+		return "", err
+	}
+	sshConfig, err := ReadConfigFile(sshConfigPath)
+	if err != nil {
+		return "", err
+	}
+	return sshConfig.legacyBlocks()[cfg.host], nil
+}
 
-	// Check if the file already contains a configuration for this host
-	if strings.Contains(sshConfigContent, headerTag) {
-		// Find the start and end of the existing section for the host
-		start := strings.Index(sshConfigContent, headerTag)
-		end := strings.Index(sshConfigContent, footerTag)
+// IsIncluded reports whether ~/.ssh/config includes the managed file.
+func (cfg *SSHManager) IsIncluded() (bool, error) {
+	sshConfigPath, err := ConfigPath()
+	if err != nil {
+		return false, err
+	}
+	sshConfig, err := ReadConfigFile(sshConfigPath)
+	if err != nil {
+		return false, err
+	}
+	return sshConfig.HasInclude(cfg.ConfigFile()), nil
+}
 
-		if start >= 0 && end > start {
-			// Replace the existing section with the new configuration
-			sshConfigContent = sshConfigContent[:start+len(headerTag)] + "\n" + newConfig + "\n" + sshConfigContent[end:]
-		}
-	} else {
-		// If the section for the host doesn't exist, add it with the new configuration
-		sshConfigContent += "\n" + headerTag + "\n" + newConfig + "\n" + footerTag + "\n"
+// AddSSHConfig writes the Host block of the host to the managed file and includes that
+// file from ~/.ssh/config. Blocks older versions wrote between markers in ~/.ssh/config
+// are moved to the managed file.
+func (cfg *SSHManager) AddSSHConfig() error {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	sshConfigPath, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	newConfig, err := cfg.ConfigBlock()
+	if err != nil {
+		return err
 	}
 
-	// Write the updated SSH config back to the file
-	err = os.WriteFile(sshConfigPath, []byte(sshConfigContent), 0644)
+	sshConfig, err := ReadConfigFile(sshConfigPath)
+	if err != nil {
+		return err
+	}
+	managed, err := ReadConfigFile(cfg.ConfigFile())
 	if err != nil {
-		return fmt.Errorf("error writing to SSH config file: %v", err)
+		return err
+	}
+
+	legacy := sshConfig.legacyBlocks()
+	for host, block := range legacy {
+		if managed.HostBlock(host) == "" {
+			managed.SetHostBlock(host, block)
+		}
+		cfg.logger.Debug("moved the SSH config of %s to %s", host, managed.Path())
+	}
+	managed.SetHostBlock(cfg.Alias(), newConfig)
+	// the block written under a previous alias would keep using the key
+	for _, host := range managed.HostsWith("IdentityFile", filepath.Join(cfg.path, cfg.keyName)) {
+		if host != cfg.Alias() {
+			managed.RemoveHostBlock(host)
+			cfg.logger.Info("removed Host %s from %s, the key is now used through Host %s", host, managed.Path(), cfg.Alias())
+		}
+	}
+	if err := cfg.files.WriteFile(managed.Path(), []byte(managed.String()), managed.Mode()); err != nil {
+		return err
 	}
+	cfg.logger.Debug("wrote SSH config for %s to %s", cfg.host, managed.Path())
 
+	included := sshConfig.HasInclude(managed.Path())
+	if !included {
+		sshConfig.AddInclude(managed.Path())
+	}
+	if !included || len(legacy) > 0 {
+		if err := cfg.files.WriteFile(sshConfigPath, []byte(sshConfig.String()), sshConfig.Mode()); err != nil {
+			return err
+		}
+		cfg.logger.Debug("included %s from %s", managed.Path(), sshConfigPath)
+	}
+
+	for _, line := range sshConfig.HostLines(cfg.Alias()) {
+		cfg.logger.Warn("%s:%d also configures Host %s, ssh applies its options after the ones of %s", sshConfigPath, line, cfg.Alias(), managed.Path())
+	}
 	return nil
 }
 
-// GenerateSSHKeyPair generates an SSH key pair (private and public).
-func (cfg *SSHManager) GenerateSSHKeyPair() (privateKeyPath, publicKeyPath string, err error) {
-	// Ensure the SSH path exists, if not create it
-	if _, err := os.Stat(cfg.path); os.IsNotExist(err) {
-		if err := os.MkdirAll(cfg.path, os.ModePerm); err != nil {
-			return "", "", fmt.Errorf("failed to create SSH directory: %w", err)
+// RemoveSSHConfig removes the Host block of the host from the managed file, and the one
+// older versions wrote to ~/.ssh/config. With its last block the managed file is deleted
+// and its Include removed. It reports whether there was a block to remove.
+func (cfg *SSHManager) RemoveSSHConfig() (bool, error) {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	sshConfigPath, err := ConfigPath()
+	if err != nil {
+		return false, err
+	}
+	sshConfig, err := ReadConfigFile(sshConfigPath)
+	if err != nil {
+		return false, err
+	}
+	managed, err := ReadConfigFile(cfg.ConfigFile())
+	if err != nil {
+		return false, err
+	}
+
+	removed := managed.RemoveHostBlock(cfg.Alias())
+	sshConfigChanged := false
+	if removed && len(managed.Hosts()) == 0 {
+		if err := cfg.files.Remove(managed.Path()); err != nil {
+			return false, err
+		}
+		sshConfigChanged = sshConfig.RemoveInclude(managed.Path())
+	} else if removed {
+		if err := cfg.files.WriteFile(managed.Path(), []byte(managed.String()), managed.Mode()); err != nil {
+			return false, err
+		}
+	}
+	if sshConfig.removeLegacyBlock(cfg.host) != "" {
+		removed, sshConfigChanged = true, true
+	}
+	if sshConfigChanged {
+		if err := cfg.files.WriteFile(sshConfigPath, []byte(sshConfig.String()), sshConfig.Mode()); err != nil {
+			return false, err
+		}
+	}
+	if removed {
+		cfg.logger.Debug("removed the SSH config of %s", cfg.Alias())
+	}
+	return removed, nil
+}
+
+// KeyFiles returns the files of the manager's key pair that exist, the private key first.
+// Either may be missing or unreadable as a key.
+func (cfg *SSHManager) KeyFiles() []string {
+	privateKeyPath := filepath.Join(cfg.path, cfg.keyName)
+	var files []string
+	for _, path := range []string{privateKeyPath, privateKeyPath + ".pub"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// RemoveKeyPair deletes the manager's key pair and returns the files it removed.
+func (cfg *SSHManager) RemoveKeyPair() ([]string, error) {
+	privateKeyPath := filepath.Join(cfg.path, cfg.keyName)
+	var removed []string
+	for _, path := range cfg.KeyFiles() {
+		remove := cfg.files.Remove
+		if path == privateKeyPath {
+			remove = cfg.files.RemoveSecret
+		}
+		if err := remove(path); err != nil {
+			return removed, err
 		}
+		removed = append(removed, path)
 	}
+	return removed, nil
+}
+
+// KeyInfo describes the local key pair of a manager.
+type KeyInfo struct {
+	Path        string
+	Type        string
+	Fingerprint string
+}
+
+// LocalKey reads the public key of the manager's key pair. The error wraps
+// os.ErrNotExist when the key has not been generated.
+func (cfg *SSHManager) LocalKey() (*KeyInfo, error) {
+	privateKeyPath := filepath.Join(cfg.path, cfg.keyName)
+	data, err := os.ReadFile(privateKeyPath + ".pub")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	return &KeyInfo{
+		Path:        privateKeyPath,
+		Type:        key.Type(),
+		Fingerprint: ssh.FingerprintSHA256(key),
+	}, nil
+}
+
+// HasSSHConfig reports whether the SSH config contains the block generated for the host.
+func (cfg *SSHManager) HasSSHConfig() (bool, error) {
+	block, err := cfg.CurrentConfigBlock()
+	return block != "", err
+}
 
+// GenerateSSHKeyPair generates an SSH key pair (private and public).
+func (cfg *SSHManager) GenerateSSHKeyPair() (privateKeyPath, publicKeyPath string, err error) {
 	// Define the paths for the private and public keys
 	privateKeyPath = filepath.Join(cfg.path, cfg.keyName)
 	publicKeyPath = privateKeyPath + ".pub"
@@ -138,24 +422,9 @@ func (cfg *SSHManager) GenerateSSHKeyPair() (privateKeyPath, publicKeyPath strin
 		return "", "", fmt.Errorf("failed to generate private key: %w", err)
 	}
 
-	// Write the private key to a file in PEM format
-	privateKeyFile, err := os.Create(privateKeyPath)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to create private key file: %w", err)
-	}
-	defer privateKeyFile.Close()
-
 	// Encode the private key in PEM format
 	privKeyBytes := x509.MarshalPKCS1PrivateKey(privateKey)
-	err = pem.Encode(privateKeyFile, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: privKeyBytes})
-	if err != nil {
-		return "", "", fmt.Errorf("failed to encode private key: %w", err)
-	}
-
-	// Set permissions to 600 for the private key
-	if err := os.Chmod(privateKeyPath, 0600); err != nil {
-		return "", "", fmt.Errorf("failed to set permissions on private key: %w", err)
-	}
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: privKeyBytes})
 
 	// Generate the corresponding public key
 	publicKey := &privateKey.PublicKey
@@ -166,17 +435,25 @@ func (cfg *SSHManager) GenerateSSHKeyPair() (privateKeyPath, publicKeyPath strin
 		return "", "", fmt.Errorf("failed to convert public key to SSH format: %w", err)
 	}
 
-	// Write the public key to the file in the proper SSH format
-	publicKeyFile, err := os.Create(publicKeyPath)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to create public key file: %w", err)
+	// Write the private key readable by the owner only, creating the SSH directory when needed
+	if err := cfg.files.WriteSecret(privateKeyPath, privateKeyPEM, 0600); err != nil {
+		return "", "", fmt.Errorf("failed to write private key: %w", err)
 	}
-	defer publicKeyFile.Close()
 
-	_, err = publicKeyFile.Write(ssh.MarshalAuthorizedKey(sshPubKey))
-	if err != nil {
+	// Write the public key to the file in the proper SSH format
+	if err := cfg.files.WriteFile(publicKeyPath, ssh.MarshalAuthorizedKey(sshPubKey), 0644); err != nil {
 		return "", "", fmt.Errorf("failed to write public key to file: %w", err)
 	}
+	cfg.logger.Debug("generated SSH key pair %s", privateKeyPath)
 
 	return privateKeyPath, publicKeyPath, nil
 }
+
+// Fingerprint returns the SHA256 fingerprint of a public key in authorized_keys format.
+func Fingerprint(authorizedKey string) (string, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(authorizedKey))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse public key: %w", err)
+	}
+	return ssh.FingerprintSHA256(key), nil
+}
@@ -1,5 +1,10 @@
 package ssh
 
+import (
+	"github.com/atnomoverflow/git-auth/pkg/files"
+	l "github.com/atnomoverflow/git-auth/pkg/logger"
+)
+
 type Options func(*SSHManager)
 
 func WithPath(path string) Options {
@@ -19,3 +24,45 @@ func WithKeyName(name string) Options {
 		ssh.keyName = name
 	}
 }
+
+// WithLogger sets where the manager logs, nothing is logged by default.
+func WithLogger(logger l.Printer) Options {
+	return func(ssh *SSHManager) {
+		if logger != nil {
+			ssh.logger = logger
+		}
+	}
+}
+
+// WithKnownHostsFile sets the known_hosts file host keys are written to. A file other
+// than ~/.ssh/known_hosts is added to the UserKnownHostsFile of the generated Host block.
+func WithKnownHostsFile(path string) Options {
+	return func(ssh *SSHManager) {
+		ssh.knownHostsFile = path
+	}
+}
+
+// WithConfigFile sets the file the Host blocks are written to and included from
+// ~/.ssh/config, ~/.ssh/config.d/git-auth by default.
+func WithConfigFile(path string) Options {
+	return func(ssh *SSHManager) {
+		ssh.configFile = path
+	}
+}
+
+// WithHostOptions sets the alias and the options of the generated Host block.
+func WithHostOptions(options HostOptions) Options {
+	return func(ssh *SSHManager) {
+		ssh.hostOptions = options
+	}
+}
+
+// WithWriter sets the writer the manager changes files with, so changes can be backed
+// up or only printed. Files are changed in place by default.
+func WithWriter(w *files.Writer) Options {
+	return func(ssh *SSHManager) {
+		if w != nil {
+			ssh.files = w
+		}
+	}
+}
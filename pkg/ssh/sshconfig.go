@@ -0,0 +1,348 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// filesMu serializes the edits of the SSH config and known_hosts files, which the
+// managers of several profiles share when they run concurrently.
+var filesMu sync.Mutex
+
+// ConfigFile is an ssh_config file kept line by line, so rewriting a Host block leaves
+// the rest of the file, comments and formatting included, as it was.
+type ConfigFile struct {
+	path  string
+	mode  os.FileMode
+	lines []string
+}
+
+// hostBlock locates a Host section of a ConfigFile. end is one past its last directive,
+// so comments and blank lines that follow it stay with whatever comes next.
+type hostBlock struct {
+	start, end int
+	patterns   []string
+}
+
+// ReadConfigFile parses the ssh_config file at path. A missing file is empty and will
+// be created with mode 0600.
+func ReadConfigFile(path string) (*ConfigFile, error) {
+	f := &ConfigFile{path: path, mode: 0600}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading SSH config file: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading SSH config file: %w", err)
+	}
+	f.mode = info.Mode().Perm()
+	if content := strings.TrimSuffix(string(data), "\n"); content != "" {
+		f.lines = strings.Split(content, "\n")
+	}
+	return f, nil
+}
+
+// Path returns the location of the file.
+func (f *ConfigFile) Path() string {
+	return f.path
+}
+
+// String returns the content of the file.
+func (f *ConfigFile) String() string {
+	if len(f.lines) == 0 {
+		return ""
+	}
+	return strings.Join(f.lines, "\n") + "\n"
+}
+
+// Mode returns the permissions of the file, 0600 for a new one.
+func (f *ConfigFile) Mode() os.FileMode {
+	return f.mode
+}
+
+// HostBlock returns the first Host section matching host exactly, empty when there is none.
+func (f *ConfigFile) HostBlock(host string) string {
+	for _, b := range f.blocks() {
+		if b.has(host) {
+			return strings.Join(f.lines[b.start:b.end], "\n") + "\n"
+		}
+	}
+	return ""
+}
+
+// HostLines returns the line numbers, starting at 1, of the Host sections naming host.
+func (f *ConfigFile) HostLines(host string) []int {
+	var lines []int
+	for _, b := range f.blocks() {
+		if b.has(host) {
+			lines = append(lines, b.start+1)
+		}
+	}
+	return lines
+}
+
+// SetHostBlock replaces the first Host section matching host with block, or appends
+// block separated by a blank line when there is none.
+func (f *ConfigFile) SetHostBlock(host, block string) {
+	blockLines := strings.Split(strings.TrimRight(block, "\n"), "\n")
+	for _, b := range f.blocks() {
+		if b.has(host) {
+			f.splice(b.start, b.end, blockLines)
+			return
+		}
+	}
+	if n := len(f.lines); n > 0 && strings.TrimSpace(f.lines[n-1]) != "" {
+		f.lines = append(f.lines, "")
+	}
+	f.lines = append(f.lines, blockLines...)
+}
+
+// RemoveHostBlock removes every Host section matching host with the blank line
+// separating it from the previous one, and reports whether there was one.
+func (f *ConfigFile) RemoveHostBlock(host string) bool {
+	blocks := f.blocks()
+	removed := false
+	for i := len(blocks) - 1; i >= 0; i-- {
+		b := blocks[i]
+		if !b.has(host) {
+			continue
+		}
+		start := b.start
+		if start > 0 && strings.TrimSpace(f.lines[start-1]) == "" {
+			start--
+		}
+		f.splice(start, b.end, nil)
+		removed = true
+	}
+	if removed && len(f.lines) > 0 && strings.TrimSpace(f.lines[0]) == "" {
+		f.splice(0, 1, nil)
+	}
+	return removed
+}
+
+// HostsWith returns the first pattern of each Host section setting keyword to value.
+func (f *ConfigFile) HostsWith(keyword, value string) []string {
+	var hosts []string
+	for _, b := range f.blocks() {
+		for _, line := range f.lines[b.start+1 : b.end] {
+			if k, args := directive(line); k == strings.ToLower(keyword) && strings.Trim(args, `"`) == value {
+				hosts = append(hosts, strings.Trim(b.patterns[0], `"`))
+				break
+			}
+		}
+	}
+	return hosts
+}
+
+// Hosts returns the patterns of each Host section.
+func (f *ConfigFile) Hosts() []string {
+	var hosts []string
+	for _, b := range f.blocks() {
+		hosts = append(hosts, strings.Join(b.patterns, " "))
+	}
+	return hosts
+}
+
+// HasInclude reports whether an Include directive before the first Host or Match
+// section loads path, directly or through a glob.
+func (f *ConfigFile) HasInclude(path string) bool {
+	for _, line := range f.lines {
+		keyword, args := directive(line)
+		if keyword == "host" || keyword == "match" {
+			return false
+		}
+		if keyword != "include" {
+			continue
+		}
+		for _, pattern := range strings.Fields(args) {
+			pattern = f.includePath(strings.Trim(pattern, `"`))
+			if ok, _ := filepath.Match(pattern, path); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AddInclude inserts an Include directive for path at the top of the file. ssh applies
+// an Include found inside a Host section only to that section, so it cannot go last.
+func (f *ConfigFile) AddInclude(path string) {
+	if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(path, home+string(filepath.Separator)) {
+		path = "~" + strings.TrimPrefix(path, home)
+	}
+	include := []string{"Include " + path}
+	if len(f.lines) > 0 && strings.TrimSpace(f.lines[0]) != "" {
+		include = append(include, "")
+	}
+	f.splice(0, 0, include)
+}
+
+// RemoveInclude removes the Include directives naming path itself, not through a glob,
+// and the blank line AddInclude put after them. It reports whether there was one.
+func (f *ConfigFile) RemoveInclude(path string) bool {
+	removed := false
+	for i := 0; i < len(f.lines); i++ {
+		keyword, args := directive(f.lines[i])
+		if keyword == "host" || keyword == "match" {
+			break
+		}
+		if keyword != "include" {
+			continue
+		}
+		var kept []string
+		for _, arg := range strings.Fields(args) {
+			if f.includePath(strings.Trim(arg, `"`)) != path {
+				kept = append(kept, arg)
+			}
+		}
+		if len(kept) == len(strings.Fields(args)) {
+			continue
+		}
+		removed = true
+		if len(kept) > 0 {
+			f.lines[i] = "Include " + strings.Join(kept, " ")
+			continue
+		}
+		end := i + 1
+		if i == 0 && end < len(f.lines) && strings.TrimSpace(f.lines[end]) == "" {
+			end++
+		}
+		f.splice(i, end, nil)
+		i--
+	}
+	return removed
+}
+
+// includePath resolves an Include argument the way ssh does, relative paths being
+// relative to the directory of the user config.
+func (f *ConfigFile) includePath(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	if !filepath.IsAbs(path) {
+		return filepath.Join(filepath.Dir(f.path), path)
+	}
+	return path
+}
+
+func (f *ConfigFile) splice(start, end int, lines []string) {
+	rest := append([]string{}, f.lines[end:]...)
+	f.lines = append(append(f.lines[:start], lines...), rest...)
+}
+
+func (f *ConfigFile) blocks() []hostBlock {
+	var blocks []hostBlock
+	var current *hostBlock
+	for i, line := range f.lines {
+		keyword, args := directive(line)
+		switch keyword {
+		case "":
+			continue
+		case "host", "match":
+			if current != nil {
+				blocks = append(blocks, *current)
+				current = nil
+			}
+			if keyword == "host" {
+				current = &hostBlock{start: i, end: i + 1, patterns: strings.Fields(args)}
+			}
+		default:
+			if current != nil {
+				current.end = i + 1
+			}
+		}
+	}
+	if current != nil {
+		blocks = append(blocks, *current)
+	}
+	return blocks
+}
+
+func (b hostBlock) has(host string) bool {
+	for _, pattern := range b.patterns {
+		if strings.Trim(pattern, `"`) == host {
+			return true
+		}
+	}
+	return false
+}
+
+// directive returns the lower case keyword and the arguments of a config line, an empty
+// keyword for blank lines and comments. Keywords are separated by spaces or an "=".
+func directive(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", ""
+	}
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), ""
+	}
+	args := strings.TrimSpace(line[end:])
+	args = strings.TrimSpace(strings.TrimPrefix(args, "="))
+	return strings.ToLower(line[:end]), args
+}
+
+// legacyBlocks removes the sections older versions wrote to ~/.ssh/config between
+// "# BEGIN GENERATED CONFIG FOR <host>" and "# END GENERATED CONFIG FOR <host>" and
+// returns them by host. A marker without its pair is left in place.
+func (f *ConfigFile) legacyBlocks() map[string]string {
+	var hosts []string
+	for _, line := range f.lines {
+		if host, ok := strings.CutPrefix(strings.TrimSpace(line), legacyBegin); ok {
+			hosts = append(hosts, host)
+		}
+	}
+	blocks := map[string]string{}
+	for _, host := range hosts {
+		if block := f.removeLegacyBlock(host); block != "" {
+			blocks[host] = block
+		}
+	}
+	return blocks
+}
+
+// removeLegacyBlock removes the marked section of host and returns its content, empty
+// when there is none.
+func (f *ConfigFile) removeLegacyBlock(host string) string {
+	start, end := -1, -1
+	for i, line := range f.lines {
+		switch strings.TrimSpace(line) {
+		case legacyBegin + host:
+			if start < 0 {
+				start = i
+			}
+		case legacyEnd + host:
+			if start >= 0 && end < 0 {
+				end = i
+			}
+		}
+	}
+	if start < 0 || end < 0 {
+		return ""
+	}
+	block := strings.TrimSpace(strings.Join(f.lines[start+1:end], "\n")) + "\n"
+	// the blank line written in front of the marker, kept when it separates
+	// what comes before from what comes after
+	next := end + 1
+	if start > 0 && strings.TrimSpace(f.lines[start-1]) == "" &&
+		(next == len(f.lines) || strings.TrimSpace(f.lines[next]) == "") {
+		start--
+	}
+	f.splice(start, next, nil)
+	return block
+}
+
+const (
+	legacyBegin = "# BEGIN GENERATED CONFIG FOR "
+	legacyEnd   = "# END GENERATED CONFIG FOR "
+)
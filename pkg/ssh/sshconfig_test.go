@@ -0,0 +1,177 @@
+package ssh
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newConfigFile returns a ConfigFile at path holding text, as ReadConfigFile would
+func newConfigFile(path, text string) *ConfigFile {
+	f := &ConfigFile{path: path, mode: 0600}
+	if content := strings.TrimSuffix(text, "\n"); content != "" {
+		f.lines = strings.Split(content, "\n")
+	}
+	return f
+}
+
+func TestBlocks(t *testing.T) {
+	for _, tc := range []struct {
+		name, config string
+		want         []hostBlock
+	}{
+		{"empty", "", nil},
+		{"no host", "Include ~/.ssh/config.d/*\nUser git\n", nil},
+		{
+			"comments and blank lines stay out of the block",
+			"Host a\n  HostName a.example.com\n\n# about b\nHost b c\n  Port 2222\n",
+			[]hostBlock{
+				{start: 0, end: 2, patterns: []string{"a"}},
+				{start: 4, end: 6, patterns: []string{"b", "c"}},
+			},
+		},
+		{
+			"match ends a block",
+			"Host a\n  User git\nMatch host b\n  User other\nHost=c\n",
+			[]hostBlock{
+				{start: 0, end: 2, patterns: []string{"a"}},
+				{start: 4, end: 5, patterns: []string{"c"}},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := newConfigFile("/tmp/config", tc.config).blocks(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("blocks() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSetHostBlock(t *testing.T) {
+	block := "Host gitlab.com\n  IdentityFile ~/.ssh/work\n"
+	for _, tc := range []struct {
+		name, config, want string
+	}{
+		{"empty file", "", block},
+		{
+			"appended after a blank line",
+			"# mine\nHost github.com\n  User git\n",
+			"# mine\nHost github.com\n  User git\n\n" + block,
+		},
+		{
+			"replaced in place, comments kept",
+			"Host gitlab.com\n  IdentityFile ~/.ssh/old\n  Port 22\n# next\nHost other\n  User me\n",
+			block + "# next\nHost other\n  User me\n",
+		},
+		{
+			"only the first match is replaced",
+			"Host gitlab.com\n  Port 1\n\nHost gitlab.com\n  Port 2\n",
+			block + "\nHost gitlab.com\n  Port 2\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newConfigFile("/tmp/config", tc.config)
+			f.SetHostBlock("gitlab.com", block)
+			if got := f.String(); got != tc.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRemoveHostBlock(t *testing.T) {
+	for _, tc := range []struct {
+		name, config, want string
+		removed            bool
+	}{
+		{"missing", "Host other\n  User me\n", "Host other\n  User me\n", false},
+		{"only block", "Host gitlab.com\n  Port 22\n", "", true},
+		{
+			"first block takes no blank line from the next",
+			"Host gitlab.com\n  Port 22\n\nHost other\n  User me\n",
+			"Host other\n  User me\n",
+			true,
+		},
+		{
+			"every match with its separating blank line",
+			"Host a\n  User me\n\nHost gitlab.com\n  Port 1\n\nHost b\n  User me\n\nHost x gitlab.com\n  Port 2\n",
+			"Host a\n  User me\n\nHost b\n  User me\n",
+			true,
+		},
+		{"patterns are not globs", "Host *.com\n  Port 22\n", "Host *.com\n  Port 22\n", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newConfigFile("/tmp/config", tc.config)
+			if removed := f.RemoveHostBlock("gitlab.com"); removed != tc.removed {
+				t.Errorf("removed = %v, want %v", removed, tc.removed)
+			}
+			if got := f.String(); got != tc.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHostsWith(t *testing.T) {
+	f := newConfigFile("/tmp/config", "Host a\n  IdentityFile /k/work\nHost b c\n  identityfile=\"/k/work\"\nHost d\n  IdentityFile /k/home\n")
+	if got, want := f.HostsWith("IdentityFile", "/k/work"), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("HostsWith() = %v, want %v", got, want)
+	}
+}
+
+func TestLegacyBlocks(t *testing.T) {
+	for _, tc := range []struct {
+		name, config, rest string
+		want               map[string]string
+	}{
+		{"none", "Host a\n  User me\n", "Host a\n  User me\n", map[string]string{}},
+		{
+			"marked blocks are taken out",
+			"Host a\n  User me\n\n" + legacyBegin + "gitlab.com\nHost gitlab.com\n  Port 22\n" + legacyEnd + "gitlab.com\n\nHost b\n  User me\n",
+			"Host a\n  User me\n\nHost b\n  User me\n",
+			map[string]string{"gitlab.com": "Host gitlab.com\n  Port 22\n"},
+		},
+		{
+			"an unpaired marker is left in place",
+			legacyBegin + "gitlab.com\nHost gitlab.com\n  Port 22\n",
+			legacyBegin + "gitlab.com\nHost gitlab.com\n  Port 22\n",
+			map[string]string{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newConfigFile("/tmp/config", tc.config)
+			if got := f.legacyBlocks(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("legacyBlocks() = %q, want %q", got, tc.want)
+			}
+			if got := f.String(); got != tc.rest {
+				t.Errorf("left\n%s\nwant\n%s", got, tc.rest)
+			}
+		})
+	}
+}
+
+func TestHasInclude(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	config := filepath.Join(home, ".ssh", "config")
+	managed := filepath.Join(home, ".ssh", "config.d", "git-auth")
+	for _, tc := range []struct {
+		name, config string
+		want         bool
+	}{
+		{"missing", "Host a\n  User me\n", false},
+		{"home path", "Include ~/.ssh/config.d/git-auth\n", true},
+		{"glob", "Include ~/.ssh/config.d/*\n", true},
+		{"relative to the config", "Include config.d/git-auth\n", true},
+		{"among several arguments", "Include /etc/ssh/extra \"~/.ssh/config.d/git-auth\"\n", true},
+		{"other file", "Include ~/.ssh/config.d/other\n", false},
+		{"inside a Host section", "Host a\n  User me\nInclude ~/.ssh/config.d/git-auth\n", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := newConfigFile(config, tc.config).HasInclude(managed); got != tc.want {
+				t.Errorf("HasInclude() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
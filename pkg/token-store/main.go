@@ -5,6 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sync"
+
+	"github.com/atnomoverflow/git-auth/pkg/files"
 )
 
 var (
@@ -20,10 +23,13 @@ type Token struct {
 
 type TokenStore struct {
 	filePath string
+	// mu serializes the read-modify-write cycles of the file
+	mu    sync.Mutex
+	files *files.Writer
 }
 
 // New initializes a new TokenStore
-func New(path string) *TokenStore {
+func New(path string, ops ...Options) *TokenStore {
 	// Ensure the directory exists
 	if err := os.MkdirAll(path, os.ModePerm); err != nil {
 		fmt.Println("Error creating directory:", err)
@@ -38,13 +44,20 @@ func New(path string) *TokenStore {
 			return nil
 		}
 	}
-	return &TokenStore{
+	store := &TokenStore{
 		filePath: filePath,
+		files:    files.New(),
+	}
+	for _, op := range ops {
+		op(store)
 	}
+	return store
 }
 
 // AddToken adds or updates a token for the given profile
 func (s *TokenStore) AddToken(token *Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	// Read existing tokens
 	tokens, err := s.readTokens()
@@ -73,6 +86,8 @@ func (s *TokenStore) AddToken(token *Token) error {
 
 // RemoveToken removes a token for a specific profile
 func (s *TokenStore) RemoveToken(profile string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	// Read existing tokens
 	tokens, err := s.readTokens()
@@ -94,6 +109,8 @@ func (s *TokenStore) RemoveToken(profile string) error {
 
 // ListTokens lists all tokens, optionally removing expired ones
 func (s *TokenStore) ListTokens() ([]Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	// Read existing tokens
 	tokens, err := s.readTokens()
 	if err != nil {
@@ -149,6 +166,6 @@ func (s *TokenStore) writeTokens(tokens []Token) error {
 		return fmt.Errorf("failed to marshal JSON: %w", err)
 	}
 
-	// Write the JSON data to the file
-	return os.WriteFile(s.filePath, data, 0644)
+	// Write the JSON data to the file, readable by the owner only as it holds the tokens
+	return s.files.WriteSecret(s.filePath, data, 0600)
 }
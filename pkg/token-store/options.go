@@ -0,0 +1,15 @@
+package tokenstore
+
+import "github.com/atnomoverflow/git-auth/pkg/files"
+
+type Options func(*TokenStore)
+
+// WithWriter sets the writer the store changes its file with, so changes can be
+// backed up or only printed. The file is changed in place by default.
+func WithWriter(w *files.Writer) Options {
+	return func(s *TokenStore) {
+		if w != nil {
+			s.files = w
+		}
+	}
+}